@@ -0,0 +1,187 @@
+// Package audit 审计日志，每条记录携带前一条记录的 hash，可通过 Verify 检测删除或篡改
+package audit
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/logger"
+	"gopkg.in/ini.v1"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+const (
+	DefaultName    = "audit"
+	DefaultMaxSize = 1 << 10 // 1GB
+
+	timeFormat = "2006-01-02T15:04:05.000000Z07:00"
+	hashField  = `,"hash":"`
+)
+
+// ContextFields extracts extra fields (request id, client ip...) from the context passed to Record
+var ContextFields func(ctx context.Context) map[string]interface{}
+
+var (
+	auditConf *ini.Section
+
+	mu     sync.Mutex
+	writer *lumberjack.Logger
+	seq    uint64
+	prev   string
+)
+
+func init() {
+	auditConf = config.Section("audit")
+}
+
+// Entry is one line of the audit log
+type Entry struct {
+	Seq      uint64          `json:"seq"`
+	Time     string          `json:"time"`
+	Actor    string          `json:"actor"`
+	Action   string          `json:"action"`
+	Resource string          `json:"resource"`
+	Details  json.RawMessage `json:"details,omitempty"`
+	Context  json.RawMessage `json:"context,omitempty"`
+	Prev     string          `json:"prev"`
+	Hash     string          `json:"-"`
+}
+
+// FileName returns the path of the current audit log file
+func FileName() string {
+	return filepath.Join(logger.GetPath(), auditConf.Key("name").MustString(DefaultName)+".log")
+}
+
+func open() error {
+	if writer != nil {
+		return nil
+	}
+
+	fileName := FileName()
+	if err := terminate(fileName); err != nil {
+		return err
+	}
+	last, err := lastEntry(fileName)
+	if err != nil {
+		return err
+	}
+	if last != nil {
+		seq, prev = last.Seq, last.Hash
+	}
+
+	writer = &lumberjack.Logger{
+		Filename:  fileName,
+		MaxSize:   auditConf.Key("maxsize").MustInt(DefaultMaxSize), // MB
+		LocalTime: true,
+		Compress:  auditConf.Key("compress").MustBool(false),
+	}
+	return nil
+}
+
+// Record 写入一条审计日志，写入失败时返回错误，调用方应据此决定是否拒绝操作
+func Record(ctx context.Context, actor, action, resource string, details interface{}) error {
+	e := Entry{
+		Time:     time.Now().Format(timeFormat),
+		Actor:    actor,
+		Action:   action,
+		Resource: resource,
+	}
+
+	var err error
+	if details != nil {
+		if e.Details, err = json.Marshal(details); err != nil {
+			return err
+		}
+	}
+	if ContextFields != nil && ctx != nil {
+		if fields := ContextFields(ctx); len(fields) > 0 {
+			if e.Context, err = json.Marshal(fields); err != nil {
+				return err
+			}
+		}
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err = open(); err != nil {
+		return err
+	}
+
+	e.Seq = seq + 1
+	e.Prev = prev
+	line, err := encode(&e)
+	if err != nil {
+		return err
+	}
+	if _, err = writer.Write(line); err != nil {
+		return err
+	}
+
+	seq, prev = e.Seq, e.Hash
+	return nil
+}
+
+// Close closes the audit log file
+func Close() error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	if writer == nil {
+		return nil
+	}
+	err := writer.Close()
+	writer = nil
+	return err
+}
+
+func sum(prev string, payload []byte) string {
+	h := sha256.New()
+	h.Write([]byte(prev))
+	h.Write(payload)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// encode 序列化 e 并追加 hash 字段，hash 覆盖 hash 字段之前的全部字节
+func encode(e *Entry) ([]byte, error) {
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return nil, err
+	}
+	e.Hash = sum(e.Prev, payload)
+
+	line := make([]byte, 0, len(payload)+len(hashField)+len(e.Hash)+3)
+	line = append(line, payload[:len(payload)-1]...)
+	line = append(line, hashField...)
+	line = append(line, e.Hash...)
+	line = append(line, "\"}\n"...)
+	return line, nil
+}
+
+// decode parses a line written by encode and reports whether its hash matches the content
+func decode(line []byte) (*Entry, bool, error) {
+	idx := bytes.LastIndex(line, []byte(hashField))
+	if idx < 0 || len(line) < idx+len(hashField)+2 {
+		return nil, false, fmt.Errorf("missing hash field")
+	}
+	hash := string(line[idx+len(hashField) : len(line)-2])
+
+	payload := make([]byte, 0, idx+1)
+	payload = append(payload, line[:idx]...)
+	payload = append(payload, '}')
+
+	var e Entry
+	if err := json.Unmarshal(payload, &e); err != nil {
+		return nil, false, err
+	}
+	e.Hash = hash
+	return &e, sum(e.Prev, payload) == hash, nil
+}
@@ -0,0 +1,171 @@
+package audit
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestEncodeDecode(t *testing.T) {
+	e := &Entry{Seq: 7, Time: "2020-01-02T03:04:05.000000Z", Actor: "admin", Action: "delete", Resource: "user:1",
+		Details: []byte(`{"reason":"spam"}`), Prev: "abc"}
+	line, err := encode(e)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasSuffix(line, []byte("\"}\n")) || e.Hash == "" {
+		t.Fatalf("line = %s, hash = %q", line, e.Hash)
+	}
+
+	got, ok, err := decode(bytes.TrimSuffix(line, []byte("\n")))
+	if err != nil || !ok {
+		t.Fatalf("decode = %v, %v", ok, err)
+	}
+	if got.Seq != e.Seq || got.Actor != e.Actor || got.Prev != e.Prev || got.Hash != e.Hash || string(got.Details) != string(e.Details) {
+		t.Errorf("decode = %+v, want %+v", got, e)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	line, err := encode(&Entry{Seq: 1, Actor: "admin", Action: "login"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line = bytes.TrimSuffix(line, []byte("\n"))
+
+	tests := []struct {
+		name string
+		line []byte
+		ok   bool
+		err  bool
+	}{
+		{"valid", line, true, false},
+		{"modified", bytes.Replace(line, []byte(`"admin"`), []byte(`"guest"`), 1), false, false},
+		{"truncated", line[:20], false, true},
+		{"no hash", []byte(`{"seq":1}`), false, true},
+		{"bad json", []byte(`{"seq":,"hash":"00"}`), false, true},
+	}
+	for _, tt := range tests {
+		_, ok, err := decode(tt.line)
+		if ok != tt.ok || (err != nil) != tt.err {
+			t.Errorf("%s: decode = %v, %v", tt.name, ok, err)
+		}
+	}
+}
+
+func writeChain(t *testing.T, fileName string, n int) {
+	t.Helper()
+	var (
+		buf  bytes.Buffer
+		prev string
+	)
+	for i := 1; i <= n; i++ {
+		e := &Entry{Seq: uint64(i), Actor: "admin", Action: "update", Prev: prev}
+		line, err := encode(e)
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(line)
+		prev = e.Hash
+	}
+	if err := ioutil.WriteFile(fileName, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestLastEntryTruncated(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	writeChain(t, fileName, 3)
+
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.WriteString(`{"seq":4,"time":"x`)
+	f.Close()
+
+	last, err := lastEntry(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last == nil || last.Seq != 3 {
+		t.Fatalf("lastEntry = %+v, want seq 3", last)
+	}
+
+	if err := terminate(fileName); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := ioutil.ReadFile(fileName)
+	if !bytes.HasSuffix(content, []byte(`"x`+"\n")) {
+		t.Errorf("file does not end with a newline: %q", content[len(content)-10:])
+	}
+
+	problems, err := Verify(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 1 || problems[0].Line != 4 {
+		t.Errorf("problems = %v, want the malformed line 4", problems)
+	}
+}
+
+func TestVerify(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "audit.log")
+	writeChain(t, fileName, 4)
+	if problems, err := Verify(fileName); err != nil || len(problems) != 0 {
+		t.Fatalf("Verify = %v, %v", problems, err)
+	}
+
+	// 删除第 2 条
+	content, _ := ioutil.ReadFile(fileName)
+	lines := bytes.SplitAfter(content, []byte("\n"))
+	ioutil.WriteFile(fileName, bytes.Join(append(lines[:1:1], lines[2:]...), nil), 0644)
+
+	problems, err := Verify(fileName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(problems) != 2 {
+		t.Errorf("problems = %v, want prev and seq mismatch", problems)
+	}
+}
+
+func TestFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, name := range []string{
+		"audit.log",
+		"audit-2020-01-02T03-04-05.000.log.gz",
+		"audit-2020-01-01T03-04-05.000.log",
+		// 同前缀的其他日志、格式不符的文件
+		"audit-gorm.log",
+		"audit-gorm.log.gz",
+		"audit-2020-01-01.log",
+		"audit-2020-01-01T03-04-05.000.txt",
+		"audit-2020-01-01T03-04-05.000.log.bak",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	files, err := Files(filepath.Join(dir, "audit.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{
+		filepath.Join(dir, "audit-2020-01-01T03-04-05.000.log"),
+		filepath.Join(dir, "audit-2020-01-02T03-04-05.000.log.gz"),
+		filepath.Join(dir, "audit.log"),
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("Files = %q, want %q", files, want)
+	}
+}
@@ -0,0 +1,210 @@
+package audit
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Problem describes a broken link of the hash chain
+type Problem struct {
+	File   string
+	Line   int
+	Reason string
+}
+
+func (p Problem) String() string {
+	return fmt.Sprintf("%s:%d: %s", p.File, p.Line, p.Reason)
+}
+
+// backupTimeFormat 为 lumberjack 备份文件名中的时间戳格式
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// Files returns the rotated backups of fileName ordered from oldest to newest, followed by fileName itself
+func Files(fileName string) ([]string, error) {
+	dir := filepath.Dir(fileName)
+	ext := filepath.Ext(fileName)
+	prefix := strings.TrimSuffix(filepath.Base(fileName), ext) + "-"
+
+	infos, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, info := range infos {
+		name := info.Name()
+		if info.IsDir() || !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		// 只匹配 lumberjack 的备份文件名 {name}-{backupTimeFormat}{ext}[.gz]，排除 audit-gorm.log 等同前缀的日志
+		ts := strings.TrimSuffix(strings.TrimPrefix(name, prefix), ".gz")
+		if !strings.HasSuffix(ts, ext) {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, strings.TrimSuffix(ts, ext)); err == nil {
+			files = append(files, filepath.Join(dir, name))
+		}
+	}
+	// lumberjack 备份文件名中的时间戳可按字典序排序
+	sort.Strings(files)
+
+	if _, err := os.Stat(fileName); err == nil {
+		files = append(files, fileName)
+	}
+	return files, nil
+}
+
+func openFile(name string) (io.ReadCloser, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	if !strings.HasSuffix(name, ".gz") {
+		return f, nil
+	}
+
+	r, err := gzip.NewReader(f)
+	if err != nil {
+		f.Close()
+		return nil, err
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{r, f}, nil
+}
+
+func eachLine(name string, fn func(n int, line []byte) error) error {
+	r, err := openFile(name)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	n := 0
+	for scanner.Scan() {
+		n++
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		if err := fn(n, scanner.Bytes()); err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+// lastEntry returns the newest valid entry of the chain, nil if nothing has been written yet.
+// Malformed lines after it (e.g. cut off by a crash mid-write) are skipped, the chain resumes from
+// the valid entry and Verify reports the broken lines
+func lastEntry(fileName string) (*Entry, error) {
+	files, err := Files(fileName)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	for i := len(files) - 1; i >= 0; i-- {
+		var last *Entry
+		err := eachLine(files[i], func(n int, line []byte) error {
+			e, _, err := decode(line)
+			if err != nil {
+				log.Printf("[audit] %s:%d: malformed entry skipped: %v", files[i], n, err)
+				return nil
+			}
+			last = e
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if last != nil {
+			return last, nil
+		}
+	}
+	return nil, nil
+}
+
+// terminate 文件末尾不是换行（写入中断）时补齐换行，新记录不与残缺行相连
+func terminate(fileName string) error {
+	f, err := os.OpenFile(fileName, os.O_RDWR, 0)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil || info.Size() == 0 {
+		return err
+	}
+	b := make([]byte, 1)
+	if _, err = f.ReadAt(b, info.Size()-1); err != nil || b[0] == '\n' {
+		return err
+	}
+	_, err = f.WriteAt([]byte{'\n'}, info.Size())
+	return err
+}
+
+// Verify walks files in order and reports every entry whose hash does not match its content (modified)
+// or whose prev / seq does not follow the previous valid entry (deleted or inserted), and malformed lines
+// such as a line cut off by a crash. The first entry of the first file is trusted as the start of the chain,
+// since old backups may have been purged.
+func Verify(files ...string) ([]Problem, error) {
+	var (
+		problems []Problem
+		last     *Entry
+	)
+
+	for _, name := range files {
+		err := eachLine(name, func(n int, line []byte) error {
+			e, ok, err := decode(line)
+			if err != nil {
+				// 之后的记录仍与上一条有效记录比对
+				problems = append(problems, Problem{name, n, "malformed entry: " + err.Error()})
+				return nil
+			}
+			if !ok {
+				problems = append(problems, Problem{name, n, fmt.Sprintf("seq %d: hash mismatch, entry modified", e.Seq)})
+			}
+			if last != nil {
+				if e.Prev != last.Hash {
+					problems = append(problems, Problem{name, n, fmt.Sprintf("seq %d: prev hash does not match seq %d", e.Seq, last.Seq)})
+				}
+				if e.Seq != last.Seq+1 {
+					problems = append(problems, Problem{name, n, fmt.Sprintf("seq %d follows seq %d, %d entries missing", e.Seq, last.Seq, int64(e.Seq)-int64(last.Seq)-1)})
+				}
+			}
+			last = e
+			return nil
+		})
+		if err != nil {
+			return problems, err
+		}
+	}
+	return problems, nil
+}
+
+// VerifyFile verifies fileName together with its rotated backups
+func VerifyFile(fileName string) ([]Problem, error) {
+	files, err := Files(fileName)
+	if err != nil {
+		return nil, err
+	}
+	return Verify(files...)
+}
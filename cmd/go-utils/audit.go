@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/qkzsky/go-utils/audit"
+)
+
+// auditCmd verifies the hash chain of the audit log and its rotated backups,
+// the file defaults to the one configured in [audit]
+func auditCmd(args []string) int {
+	if len(args) == 0 || args[0] != "verify" {
+		fmt.Fprintln(os.Stderr, "usage: go-utils audit verify [file]")
+		return 2
+	}
+
+	fileName := audit.FileName()
+	if len(args) > 1 {
+		fileName = args[1]
+	}
+
+	problems, err := audit.VerifyFile(fileName)
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[audit] "+err.Error())
+		return 1
+	}
+	if len(problems) > 0 {
+		return 1
+	}
+	fmt.Println("ok")
+	return 0
+}
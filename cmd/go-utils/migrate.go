@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/migrate"
+)
+
+// migrateCmd applies the SQL files of [migrate] dir to the configured database
+func migrateCmd(args []string) int {
+	conf := config.Section("migrate")
+
+	fs := flag.NewFlagSet("migrate", flag.ExitOnError)
+	dbName := fs.String("db", conf.Key("db").String(), "database name configured in [database]")
+	dir := fs.String("dir", conf.Key("dir").MustString("migrations"), "directory of the migration files")
+	table := fs.String("table", conf.Key("table").MustString(migrate.DefaultTable), "table recording applied versions")
+	dryRun := fs.Bool("dry-run", false, "print the SQL instead of executing it")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "usage: go-utils migrate [flags] up [n] | down [n] | status | create name")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return 2
+	}
+	action := fs.Arg(0)
+
+	if action == "create" {
+		if fs.NArg() < 2 {
+			fs.Usage()
+			return 2
+		}
+		up, down, err := migrate.Create(*dir, fs.Arg(1))
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "[migrate] "+err.Error())
+			return 1
+		}
+		fmt.Println(up)
+		fmt.Println(down)
+		return 0
+	}
+
+	if *dbName == "" {
+		fmt.Fprintln(os.Stderr, "[migrate] -db is required")
+		return 2
+	}
+	m, err := migrate.New(*dbName, *dir)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[migrate] "+err.Error())
+		return 1
+	}
+	m.Table = *table
+	m.DryRun = *dryRun
+
+	steps := 0
+	if fs.NArg() > 1 {
+		if steps, err = strconv.Atoi(fs.Arg(1)); err != nil {
+			fs.Usage()
+			return 2
+		}
+	}
+
+	ctx := context.Background()
+	switch action {
+	case "up":
+		err = m.Up(ctx, steps)
+	case "down":
+		err = m.Down(ctx, steps)
+	case "status":
+		var list []migrate.Status
+		if list, err = m.Status(ctx); err == nil {
+			for _, st := range list {
+				applied := "pending"
+				if st.Applied {
+					applied = st.AppliedAt.Format("2006-01-02 15:04:05")
+				}
+				fmt.Printf("%d\t%-40s\t%s\n", st.Version, st.Name, applied)
+			}
+		}
+	default:
+		fs.Usage()
+		return 2
+	}
+
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "[migrate] "+err.Error())
+		return 1
+	}
+	return 0
+}
@@ -8,6 +8,7 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
 const AppConfFile = "app.ini"
@@ -40,14 +41,14 @@ func NewConfig(filename string) *ini.File {
 			panic(err)
 		}
 
-		configPath = filepath.Join(tempPath, "config", filename)
-		for !utils.FileExists(configPath) {
-			if tempPath == "" {
-				log.Println(fmt.Sprintf("config file %s not existed!", filename))
-				return nil
-			}
-			tempPath = utils.ParentDirectory(tempPath)
-			configPath = filepath.Join(tempPath, "config", filename)
+		configPath = findUp(tempPath, filepath.Join("config", filename))
+		// go test 以包目录为工作目录，包内测试使用仓库 testdata/config 下的配置
+		if configPath == "" && strings.HasSuffix(os.Args[0], ".test") {
+			configPath = findUp(tempPath, filepath.Join("testdata", "config", filename))
+		}
+		if configPath == "" {
+			log.Println(fmt.Sprintf("config file %s not existed!", filename))
+			return nil
 		}
 	}
 
@@ -58,6 +59,20 @@ func NewConfig(filename string) *ini.File {
 	return cfg
 }
 
+// findUp 自 dir 逐级向上查找 name，未找到时返回空字符串
+func findUp(dir, name string) string {
+	for {
+		path := filepath.Join(dir, name)
+		if utils.FileExists(path) {
+			return path
+		}
+		if dir == "" {
+			return ""
+		}
+		dir = utils.ParentDirectory(dir)
+	}
+}
+
 func Section(name string) *ini.Section {
 	return defaultConf.Section(name)
 }
@@ -0,0 +1,229 @@
+package database
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	BulkModeInsert = "insert"
+	BulkModeIgnore = "ignore"
+	BulkModeUpsert = "upsert"
+)
+
+// placeholderLimits 单条语句的占位符上限
+var placeholderLimits = map[string]int{
+	"mysql":    65535,
+	"postgres": 65535,
+	"sqlite3":  999,
+}
+
+// BulkOptions BulkInsert 选项
+type BulkOptions struct {
+	BatchSize       int      // 每条语句的最大行数，0 时仅受占位符上限约束
+	Mode            string   // insert（默认）、ignore、upsert
+	ConflictColumns []string // PostgreSQL、SQLite ON CONFLICT 的列，默认为主键，MySQL 由唯一索引决定
+	UpdateColumns   []string // upsert 时更新的列，默认为冲突列、主键及 created_at 以外的全部列
+	Omit            []string // 不插入的列
+}
+
+// BulkInsert 以多行 INSERT 批量写入 rows（结构体或结构体指针切片），按占位符上限分批执行，返回影响行数。
+// upsert 在 MySQL 下使用 ON DUPLICATE KEY UPDATE，影响行数中更新的行计为 2；
+// PostgreSQL、SQLite 使用 ON CONFLICT DO UPDATE。分批之间不保证原子性，需要时在 WithTx 中调用。
+// 不执行 gorm 回调，不回填自增主键，created_at、updated_at 为空时写入当前时间；
+// 主键须全部为空（由数据库生成）或全部有值，混合时返回错误
+func BulkInsert(db *gorm.DB, rows interface{}, opts BulkOptions) (int64, error) {
+	rv := reflect.Indirect(reflect.ValueOf(rows))
+	if rv.Kind() != reflect.Slice {
+		return 0, fmt.Errorf("database: BulkInsert rows must be a slice, got %T", rows)
+	}
+	if rv.Len() == 0 {
+		return 0, nil
+	}
+
+	mode := opts.Mode
+	if mode == "" {
+		mode = BulkModeInsert
+	}
+	dialect := db.Dialect().GetName()
+	if mode != BulkModeInsert && dialect != "mysql" && dialect != "postgres" && dialect != "sqlite3" {
+		return 0, fmt.Errorf("database: BulkInsert mode %s is not supported by %s", mode, dialect)
+	}
+
+	omit := map[string]bool{}
+	for _, c := range opts.Omit {
+		omit[c] = true
+	}
+
+	now := gorm.NowFunc()
+	records := make([][]*gorm.Field, rv.Len())
+	var scope *gorm.Scope
+	for i := range records {
+		elem := rv.Index(i)
+		if elem.Kind() != reflect.Ptr {
+			elem = elem.Addr()
+		}
+		s := db.NewScope(elem.Interface())
+		if scope == nil {
+			scope = s
+		}
+
+		fields := s.Fields()
+		for _, f := range fields {
+			if (f.Name == "CreatedAt" || f.Name == "UpdatedAt") && f.IsBlank {
+				if err := f.Set(now); err != nil {
+					return 0, err
+				}
+			}
+		}
+		records[i] = fields
+	}
+
+	// 主键全部为空时由数据库生成，部分为空时无法在同一语句中写入，返回错误
+	var (
+		columns []string
+		indexes []int
+	)
+	for j, f := range records[0] {
+		if f.IsIgnored || !f.IsNormal || omit[f.DBName] {
+			continue
+		}
+		if f.IsPrimaryKey {
+			blank := 0
+			for _, r := range records {
+				if r[j].IsBlank {
+					blank++
+				}
+			}
+			if blank == len(records) {
+				continue
+			}
+			if blank > 0 {
+				return 0, fmt.Errorf("database: BulkInsert %s: %d of %d rows have a blank %s, set it on every row or on none",
+					scope.TableName(), blank, len(records), f.DBName)
+			}
+		}
+		columns = append(columns, f.DBName)
+		indexes = append(indexes, j)
+	}
+	if len(columns) == 0 {
+		return 0, fmt.Errorf("database: BulkInsert %s has no columns", scope.TableName())
+	}
+
+	quoted := make([]string, len(columns))
+	for i, c := range columns {
+		quoted[i] = scope.Quote(c)
+	}
+	insert := "INSERT INTO "
+	if mode == BulkModeIgnore && dialect == "mysql" {
+		insert = "INSERT IGNORE INTO "
+	}
+	stmt := insert + scope.QuotedTableName() + " (" + strings.Join(quoted, ",") + ") VALUES ?"
+
+	suffix, err := bulkSuffix(scope, dialect, mode, columns, opts)
+	if err != nil {
+		return 0, err
+	}
+	stmt += suffix
+
+	batch := len(records)
+	if limit, ok := placeholderLimits[dialect]; ok && limit/len(columns) < batch {
+		batch = limit / len(columns)
+	}
+	if opts.BatchSize > 0 && opts.BatchSize < batch {
+		batch = opts.BatchSize
+	}
+
+	var affected int64
+	for start := 0; start < len(records); start += batch {
+		end := start + batch
+		if end > len(records) {
+			end = len(records)
+		}
+
+		values := make([][]interface{}, 0, end-start)
+		for _, r := range records[start:end] {
+			row := make([]interface{}, len(indexes))
+			for i, j := range indexes {
+				row[i] = r[j].Field.Interface()
+			}
+			values = append(values, row)
+		}
+
+		result := db.Exec(stmt, values)
+		if result.Error != nil {
+			return affected, result.Error
+		}
+		affected += result.RowsAffected
+	}
+	return affected, nil
+}
+
+func bulkSuffix(scope *gorm.Scope, dialect, mode string, columns []string, opts BulkOptions) (string, error) {
+	switch mode {
+	case BulkModeInsert:
+		return "", nil
+	case BulkModeIgnore:
+		if dialect == "mysql" {
+			return "", nil
+		}
+		return " ON CONFLICT DO NOTHING", nil
+	case BulkModeUpsert:
+	default:
+		return "", fmt.Errorf("database: unknown BulkInsert mode: %s", mode)
+	}
+
+	conflict := opts.ConflictColumns
+	if len(conflict) == 0 {
+		for _, f := range scope.PrimaryFields() {
+			conflict = append(conflict, f.DBName)
+		}
+	}
+	if len(conflict) == 0 && dialect != "mysql" {
+		return "", fmt.Errorf("database: BulkInsert upsert on %s needs ConflictColumns", scope.TableName())
+	}
+
+	update := opts.UpdateColumns
+	if len(update) == 0 {
+		skip := map[string]bool{"created_at": true}
+		for _, c := range conflict {
+			skip[c] = true
+		}
+		for _, f := range scope.PrimaryFields() {
+			skip[f.DBName] = true
+		}
+		for _, c := range columns {
+			if !skip[c] {
+				update = append(update, c)
+			}
+		}
+	}
+
+	quotedConflict := make([]string, len(conflict))
+	for i, c := range conflict {
+		quotedConflict[i] = scope.Quote(c)
+	}
+	sets := make([]string, len(update))
+	for i, c := range update {
+		if dialect == "mysql" {
+			sets[i] = scope.Quote(c) + " = VALUES(" + scope.Quote(c) + ")"
+		} else {
+			sets[i] = scope.Quote(c) + " = excluded." + scope.Quote(c)
+		}
+	}
+
+	if dialect == "mysql" {
+		if len(sets) == 0 {
+			// 无可更新列时等同 ignore，但仍按唯一键去重
+			return " ON DUPLICATE KEY UPDATE " + scope.Quote(columns[0]) + " = " + scope.Quote(columns[0]), nil
+		}
+		return " ON DUPLICATE KEY UPDATE " + strings.Join(sets, ", "), nil
+	}
+	if len(sets) == 0 {
+		return " ON CONFLICT (" + strings.Join(quotedConflict, ",") + ") DO NOTHING", nil
+	}
+	return " ON CONFLICT (" + strings.Join(quotedConflict, ",") + ") DO UPDATE SET " + strings.Join(sets, ", "), nil
+}
@@ -0,0 +1,44 @@
+package database
+
+import (
+	"strings"
+	"testing"
+)
+
+type bulkUser struct {
+	ID   int
+	Name string
+}
+
+func TestBulkInsertPrimaryKeys(t *testing.T) {
+	db, err := Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&bulkUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.DropTable(&bulkUser{})
+
+	// 主键全部为空时由数据库生成
+	if n, err := BulkInsert(db, []bulkUser{{Name: "a"}, {Name: "b"}}, BulkOptions{}); err != nil || n != 2 {
+		t.Fatalf("blank keys: n = %d, %v", n, err)
+	}
+	// 主键全部有值时原样写入
+	if n, err := BulkInsert(db, []*bulkUser{{ID: 10, Name: "c"}, {ID: 11, Name: "d"}}, BulkOptions{}); err != nil || n != 2 {
+		t.Fatalf("set keys: n = %d, %v", n, err)
+	}
+	// 混合时拒绝，不写入任何行
+	n, err := BulkInsert(db, []bulkUser{{ID: 20, Name: "e"}, {Name: "f"}}, BulkOptions{})
+	if err == nil || n != 0 || !strings.Contains(err.Error(), "1 of 2 rows have a blank id") {
+		t.Fatalf("mixed keys: n = %d, %v", n, err)
+	}
+
+	var count int
+	db.Model(&bulkUser{}).Count(&count)
+	var c bulkUser
+	db.Where("id = ?", 10).First(&c)
+	if count != 4 || c.Name != "c" {
+		t.Errorf("count = %d, id 10 = %+v", count, c)
+	}
+}
@@ -0,0 +1,66 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/shutdown"
+)
+
+func init() {
+	shutdown.Register("database", CloseAllContext)
+}
+
+// CloseAll closes every handle opened by Open, NewDB and NewCluster, waiting up to shutdown.DefaultTimeout
+// for in-flight queries
+func CloseAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdown.DefaultTimeout)
+	defer cancel()
+	return CloseAllContext(ctx)
+}
+
+// CloseAllContext is like CloseAll but waits for in-flight queries until ctx is done
+func CloseAllContext(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var errs shutdown.Errors
+	clusterMap.Range(func(key, value interface{}) bool {
+		if err := value.(*Cluster).closeContext(ctx); err != nil {
+			errs = append(errs, fmt.Errorf("database %s replicas: %v", key, err))
+		}
+		return true
+	})
+	dbMap.Range(func(key, value interface{}) bool {
+		dbMap.Delete(key)
+		if err := closeDB(ctx, value.(*gorm.DB)); err != nil {
+			errs = append(errs, fmt.Errorf("database %s: %v", key, err))
+		}
+		return true
+	})
+	return errs.Err()
+}
+
+// closeDB 等待进行中的查询结束后关闭连接池，ctx 结束时不再等待
+func closeDB(ctx context.Context, db *gorm.DB) error {
+	err := shutdown.WaitIdle(ctx, func() int {
+		return db.DB().Stats().InUse
+	})
+
+	poolOptions.Delete(db.DB())
+	done := make(chan error, 1)
+	go func() {
+		done <- db.Close()
+	}()
+
+	select {
+	case e := <-done:
+		if err == nil {
+			err = e
+		}
+	case <-ctx.Done():
+		err = ctx.Err()
+	}
+	return err
+}
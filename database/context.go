@@ -0,0 +1,219 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"reflect"
+	"sync"
+	"time"
+	"unsafe"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+	"github.com/qkzsky/go-utils/trace"
+)
+
+// handleOptions 由 openDB 按连接池记录，同一连接池派生的句柄均沿用
+type handleOptions struct {
+	queryTimeout time.Duration
+}
+
+// poolOptions *sql.DB -> handleOptions，未经 openDB 打开的连接池（如 databasetest.Open）使用零值
+var poolOptions sync.Map
+
+const statementKey = "go-utils:statement"
+
+// connField 为 gorm.DB 保存连接的未导出字段，gorm v1 没有替换连接的接口
+var connField = func() reflect.StructField {
+	f, ok := reflect.TypeOf((*gorm.DB)(nil)).Elem().FieldByName("db")
+	if !ok || f.Type != reflect.TypeOf((*gorm.SQLCommon)(nil)).Elem() {
+		panic("database: unsupported gorm version, gorm.DB has no db SQLCommon field")
+	}
+	return f
+}()
+
+// setConn 将 db 的连接替换为 conn，db 须为尚未共享的克隆
+func setConn(db *gorm.DB, conn gorm.SQLCommon) {
+	f := reflect.ValueOf(db).Elem().FieldByIndex(connField.Index)
+	reflect.NewAt(f.Type(), unsafe.Pointer(f.UnsafeAddr())).Elem().Set(reflect.ValueOf(&conn).Elem())
+	db.Dialect().SetDB(conn)
+}
+
+// SQLDB returns the connection pool of db, unlike db.DB() it also unwraps handles returned by WithContext,
+// nil for transactions
+func SQLDB(db *gorm.DB) *sql.DB {
+	if c, ok := db.CommonDB().(*ctxDB); ok {
+		return c.db
+	}
+	return db.DB()
+}
+
+// ctxDB 以 ctx 执行每条语句，queryTimeout 大于 0 时每条语句单独计时。
+// scoped 为 true 时由 beginStatement 替换到 gorm 回调的 scope 上，ctx 已单独计时，span 由回调记录
+type ctxDB struct {
+	db      *sql.DB
+	ctx     context.Context
+	timeout time.Duration
+	system  string
+	scoped  bool
+}
+
+// execContext 返回单条语句使用的 ctx
+func (c *ctxDB) execContext() (context.Context, context.CancelFunc) {
+	if c.scoped || c.timeout <= 0 {
+		return c.ctx, func() {}
+	}
+	return context.WithTimeout(c.ctx, c.timeout)
+}
+
+// startSpan 为不经过 gorm 回调的语句（db.Exec、建表时的元数据查询等）记录 span
+func (c *ctxDB) startSpan() *trace.Span {
+	if c.scoped || !trace.Enabled() || trace.FromContext(c.ctx) == nil {
+		return nil
+	}
+	_, span := trace.Start(c.ctx, "db", trace.KindClient)
+	return span
+}
+
+func (c *ctxDB) Exec(query string, args ...interface{}) (sql.Result, error) {
+	span := c.startSpan()
+	ctx, cancel := c.execContext()
+	defer cancel()
+	result, err := c.db.ExecContext(ctx, query, args...)
+	if span != nil {
+		var rows int64
+		if err == nil {
+			rows, _ = result.RowsAffected()
+		}
+		finishStatementSpan(span, c.system, query, rows, err)
+	}
+	return result, err
+}
+
+func (c *ctxDB) Prepare(query string) (*sql.Stmt, error) {
+	ctx, cancel := c.execContext()
+	defer cancel()
+	return c.db.PrepareContext(ctx, query)
+}
+
+// Query、QueryRow 的结果在返回后才读取，只有经 gorm 回调执行时才单独计时，见 beginStatement
+func (c *ctxDB) Query(query string, args ...interface{}) (*sql.Rows, error) {
+	span := c.startSpan()
+	rows, err := c.db.QueryContext(c.ctx, query, args...)
+	if span != nil {
+		finishStatementSpan(span, c.system, query, 0, err)
+	}
+	return rows, err
+}
+
+func (c *ctxDB) QueryRow(query string, args ...interface{}) *sql.Row {
+	span := c.startSpan()
+	row := c.db.QueryRowContext(c.ctx, query, args...)
+	if span != nil {
+		finishStatementSpan(span, c.system, query, 0, row.Err())
+	}
+	return row
+}
+
+// Begin 事务绑定 c.ctx，不受单条语句超时限制
+func (c *ctxDB) Begin() (*sql.Tx, error) {
+	return c.db.BeginTx(c.ctx, nil)
+}
+
+func (c *ctxDB) BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error) {
+	return c.db.BeginTx(ctx, opts)
+}
+
+// statement 记录 beginStatement 替换前的连接
+type statement struct {
+	conn   *ctxDB
+	cancel context.CancelFunc
+}
+
+func init() {
+	callback := gorm.DefaultCallback
+	callback.Create().Before("gorm:create").Register("go-utils:begin_statement_create", beginStatement)
+	callback.Create().After("gorm:create").Register("go-utils:end_statement_create", endStatement)
+	callback.Query().Before("gorm:query").Register("go-utils:begin_statement_query", beginStatement)
+	callback.Query().After("gorm:query").Register("go-utils:end_statement_query", endStatement)
+	callback.Update().Before("gorm:update").Register("go-utils:begin_statement_update", beginStatement)
+	callback.Update().After("gorm:update").Register("go-utils:end_statement_update", endStatement)
+	callback.Delete().Before("gorm:delete").Register("go-utils:begin_statement_delete", beginStatement)
+	callback.Delete().After("gorm:delete").Register("go-utils:end_statement_delete", endStatement)
+	callback.RowQuery().Before("gorm:row_query").Register("go-utils:begin_statement_row_query", beginStatement)
+	callback.RowQuery().After("gorm:row_query").Register("go-utils:end_statement_row_query", endRowStatement)
+}
+
+// beginStatement 将 scope 的连接替换为单独计时的 ctxDB，语句执行完由 endStatement 取消。
+// Create、Update、Delete 默认在事务中执行，此时连接为 *sql.Tx，沿用事务的 ctx
+func beginStatement(scope *gorm.Scope) {
+	c, ok := scope.SQLDB().(*ctxDB)
+	if !ok {
+		return
+	}
+	ctx, cancel := c.ctx, context.CancelFunc(func() {})
+	if c.timeout > 0 {
+		ctx, cancel = context.WithTimeout(c.ctx, c.timeout)
+	}
+	setConn(scope.DB(), &ctxDB{db: c.db, ctx: ctx, timeout: c.timeout, system: c.system, scoped: true})
+	scope.InstanceSet(statementKey, statement{conn: c, cancel: cancel})
+}
+
+func endStatement(scope *gorm.Scope) {
+	if s, ok := restoreStatement(scope); ok {
+		s.cancel()
+	}
+}
+
+// endRowStatement Row、Rows、Count 在回调返回后才读取结果，ctx 到 query_timeout 时释放
+func endRowStatement(scope *gorm.Scope) {
+	restoreStatement(scope)
+}
+
+// restoreStatement 恢复 beginStatement 替换前的连接，scope.DB() 会作为 Find 等方法的结果返回给调用方
+func restoreStatement(scope *gorm.Scope) (statement, bool) {
+	v, ok := scope.InstanceGet(statementKey)
+	if !ok {
+		return statement{}, false
+	}
+	s := v.(statement)
+	setConn(scope.DB(), s.conn)
+	return s, true
+}
+
+// WithContext 返回绑定 ctx 的句柄，ctx 取消时中断正在执行的语句，每条语句默认超时为 [database] name.query_timeout，
+// ctx 中有 trace span 时每条语句记录子 span。
+// 返回的句柄复制 db 的查询条件及 Set、LogMode、BlockGlobalUpdate 等设置，只替换底层连接，
+// 因此其 DB() 为 nil，需要连接池时使用 SQLDB。
+// db 已处于事务中时保留原句柄，只记录 ctx 用于 trace，事务应由 BeginTx(ctx) 或 WithTx 绑定 ctx
+func WithContext(ctx context.Context, db *gorm.DB) *gorm.DB {
+	raw := SQLDB(db)
+	if raw == nil {
+		return db.Set(contextKey, ctx)
+	}
+
+	var opts handleOptions
+	if v, ok := poolOptions.Load(raw); ok {
+		opts = v.(handleOptions)
+	}
+	cdb := db.Set(contextKey, ctx)
+	setConn(cdb, &ctxDB{db: raw, ctx: ctx, timeout: opts.queryTimeout, system: db.Dialect().GetName()})
+	return cdb
+}
+
+// WithGin is WithContext bound to the request of c, queries stop when the client goes away
+func WithGin(c *gin.Context, db *gorm.DB) *gorm.DB {
+	return WithContext(c.Request.Context(), db)
+}
+
+// isCancelled reports whether err was caused by a cancelled or timed out context
+func isCancelled(err error) bool {
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return true
+	}
+	var pqErr *pq.Error
+	// query_canceled
+	return errors.As(err, &pqErr) && pqErr.Code == "57014"
+}
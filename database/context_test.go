@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+type contextUser struct {
+	ID   int
+	Name string
+}
+
+func TestWithContext(t *testing.T) {
+	db, err := Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&contextUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.DropTable(&contextUser{})
+	db.Create(&contextUser{Name: "a"})
+	db.Create(&contextUser{Name: "b"})
+
+	ctx := context.Background()
+	var n int
+	if err := WithContext(ctx, db).Model(&contextUser{}).Where("name = ?", "a").Count(&n).Error; err != nil || n != 1 {
+		t.Fatalf("root handle: count = %d, %v", n, err)
+	}
+
+	// 派生句柄的条件、设置均保留
+	n = 0
+	derived := db.Where("name = ?", "a").Set("k", "v").BlockGlobalUpdate(true)
+	bound := WithContext(ctx, derived)
+	if err := bound.Model(&contextUser{}).Count(&n).Error; err != nil || n != 1 {
+		t.Fatalf("derived handle: count = %d, %v", n, err)
+	}
+	if v, ok := bound.Get("k"); !ok || v != "v" {
+		t.Errorf("derived handle: Set value = %v, %v", v, ok)
+	}
+	if !bound.HasBlockGlobalUpdate() {
+		t.Error("derived handle: BlockGlobalUpdate lost")
+	}
+	if bound.DB() != nil || SQLDB(bound) != db.DB() {
+		t.Errorf("derived handle: DB() = %v, SQLDB = %v", bound.DB(), SQLDB(bound))
+	}
+	n = 0
+	if err := WithContext(ctx, db.Debug().Table("context_users")).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("table handle: count = %d, %v", n, err)
+	}
+
+	// WithContext 返回的句柄可再次绑定
+	bound = WithContext(ctx, db)
+	n = 0
+	if err := WithContext(ctx, bound).Model(&contextUser{}).Count(&n).Error; err != nil || n != 2 {
+		t.Fatalf("rebound handle: count = %d, %v", n, err)
+	}
+
+	// 单条语句的 ctx 在语句结束时取消，Find 返回的句柄恢复为绑定的连接
+	var users []contextUser
+	found := bound.Find(&users)
+	n = 0
+	if err := found.Model(&contextUser{}).Count(&n).Error; err != nil || len(users) != 2 || n != 2 {
+		t.Fatalf("after Find: users = %d, count = %d, %v", len(users), n, err)
+	}
+
+	cancelled, cancel := context.WithTimeout(ctx, time.Nanosecond)
+	defer cancel()
+	<-cancelled.Done()
+	if err := WithContext(cancelled, db).Model(&contextUser{}).Count(&n).Error; !isCancelled(err) {
+		t.Errorf("cancelled context: err = %v", err)
+	}
+}
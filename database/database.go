@@ -1,26 +1,30 @@
 package database
 
 import (
-	"database/sql/driver"
+	"context"
+	"database/sql"
 	"fmt"
+	"github.com/go-sql-driver/mysql"
 	"github.com/jinzhu/gorm"
 	_ "github.com/jinzhu/gorm/dialects/mysql"
 	_ "github.com/jinzhu/gorm/dialects/postgres"
+	_ "github.com/jinzhu/gorm/dialects/sqlite"
+	"github.com/lib/pq"
 	"github.com/qkzsky/go-utils/config"
-	"github.com/qkzsky/go-utils/logger"
-	"go.uber.org/zap"
+	"github.com/qkzsky/go-utils/health"
 	"gopkg.in/ini.v1"
-	"reflect"
-	"regexp"
 	"runtime"
-	"strings"
 	"sync"
 	"time"
-	"unicode"
 )
 
 const DefaultCharset = "utf8"
 const DefaultSSLMode = "disable"
+const MemoryPath = ":memory:"
+const DefaultMaxLifetime = 2 * time.Hour
+
+// driverNames gorm dialect -> database/sql 驱动名
+var driverNames = map[string]string{"mysql": "mysql", "postgres": "postgres", "sqlite3": "sqlite3"}
 
 var defaultMysqlMaxIdle = runtime.NumCPU() + 1
 var defaultMysqlMaxOpen = runtime.NumCPU()*2 + 1
@@ -29,189 +33,217 @@ var (
 	dbConf *ini.Section
 	dbMap  sync.Map
 	mu     sync.Mutex
+	confMu sync.Mutex
+	// openLocks name -> *sync.Mutex，同名句柄只连接一次，连接及重试期间不阻塞其他句柄
+	openLocks sync.Map
 )
 
 func init() {
 	dbConf = config.Section("database")
+	queryStatsMaxEntries = config.Section("gorm").Key("stats.max_fingerprints").MustInt(DefaultMaxFingerprints)
 }
 
+// NewDB is like Open but panics if the database cannot be opened
 func NewDB(databaseName string) *gorm.DB {
+	db, err := Open(databaseName)
+	if err != nil {
+		panic(err)
+	}
+	return db
+}
+
+// Open 打开并缓存 databaseName 对应的连接，连接失败时按 [database] name.retry_* 配置以指数退避重试，
+// 配置错误返回 *ConfigError，重试耗尽返回 *ConnectError
+func Open(databaseName string) (*gorm.DB, error) {
 	if db, ok := dbMap.Load(databaseName); ok {
-		return db.(*gorm.DB)
+		return db.(*gorm.DB), nil
 	}
 
-	mu.Lock()
-	defer mu.Unlock()
+	l := openLock(databaseName)
+	l.Lock()
+	defer l.Unlock()
 	if db, ok := dbMap.Load(databaseName); ok {
-		return db.(*gorm.DB)
+		return db.(*gorm.DB), nil
 	}
 
-	var err error
-	drive := dbConf.Key(databaseName + ".drive").String()
+	confMu.Lock()
 	host := dbConf.Key(databaseName + ".host").String()
 	port := dbConf.Key(databaseName + ".port").String()
-	username := dbConf.Key(databaseName + ".username").String()
-	password := dbConf.Key(databaseName + ".password").String()
-	dbName := dbConf.Key(databaseName + ".db").String()
-	sslMode := dbConf.Key(databaseName + ".sslmode").MustString(DefaultSSLMode)
-	charset := dbConf.Key(databaseName + ".charset").MustString(DefaultCharset)
-	maxOpen := dbConf.Key(databaseName + ".max_open").MustInt(defaultMysqlMaxOpen)
-	maxIdle := dbConf.Key(databaseName + ".max_idle").MustInt(defaultMysqlMaxIdle)
-
-	var dsn string
-	switch drive {
-	case "mysql":
-		dsn = fmt.Sprintf("%s:%s@tcp(%s:%s)/%s?charset=%s&parseTime=true&loc=Local&timeout=15s",
-			username, password, host, port, dbName, charset)
-	case "postgresql":
-		dsn = fmt.Sprintf("host=%s:%s user=%s password=%s dbname=%s sslmode=%s",
-			host, port, username, password, dbName, sslMode)
-	default:
-		panic(fmt.Errorf("unknown database drive: %s", drive))
-	}
-
-	db, err := gorm.Open(drive, dsn)
-	if err != nil {
-		panic(err)
-	}
-
-	err = db.DB().Ping()
+	policy := newRetryPolicy(databaseName)
+	confMu.Unlock()
+	db, err := openRetry(databaseName, host, port, policy)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	// 连接及连接池配置
-	db.DB().SetConnMaxLifetime(2 * time.Hour)
-	db.DB().SetMaxOpenConns(maxOpen)
-	db.DB().SetMaxIdleConns(maxIdle)
+	// mu 只保护与 CloseAll 的并发，不在连接期间持有
+	mu.Lock()
+	dbMap.Store(databaseName, db)
+	mu.Unlock()
+	registerHealth(databaseName, db)
 
-	gormConf := config.Section("gorm")
+	return db, nil
+}
 
-	logModeCfg := gormConf.Key("log.mode")
-	if logModeCfg.String() != "" {
-		logMode, err := logModeCfg.Bool()
-		if err != nil {
-			panic(err)
-		}
-		db.LogMode(logMode)
+// pingContext 驱动建立连接时不一定响应 ctx（如 pq 的握手），ctx 结束即返回，未完成的连接由 conn.Close 回收
+func pingContext(ctx context.Context, conn *sql.DB) error {
+	done := make(chan error, 1)
+	go func() {
+		done <- conn.PingContext(ctx)
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
 	}
+}
 
-	//var logFile *os.File
-	//fileName := logger.GetPath() + "/" + gormConf.Key("log.file").String()
-	//logFile, err = os.OpenFile(fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
-	//if err != nil {
-	//	panic(err)
-	//}
-	//db.SetLogger(gLogger{log.New(logFile, "", 0)})
-	db.SetLogger(gLogger{logger.NewLogger(config.AppName + "-gorm")})
+func openLock(key string) *sync.Mutex {
+	l, _ := openLocks.LoadOrStore(key, &sync.Mutex{})
+	return l.(*sync.Mutex)
+}
 
-	dbMap.Store(databaseName, db)
+// registerHealth 注册 database.{name} 健康检查，关闭后检查失败直至重新打开
+func registerHealth(databaseName string, db *gorm.DB) {
+	health.Register("database."+databaseName, func(ctx context.Context) error {
+		return db.DB().PingContext(ctx)
+	}, health.Options{
+		Critical: dbConf.Key(databaseName + ".health_critical").MustBool(true),
+		Timeout:  dbConf.Key(databaseName + ".health_timeout").MustDuration(0),
+	})
+}
 
-	return db
+// connOptions 为 openDB 读取的配置
+type connOptions struct {
+	dialect     string
+	dsn         string
+	addr        string
+	path        string
+	maxOpen     int
+	maxIdle     int
+	maxLifetime time.Duration
+	maxIdleTime time.Duration
+	logMode     bool
+	setLogMode  bool
+	logger      gLogger
+	handle      handleOptions
 }
 
-func isPrintable(s string) bool {
-	for _, r := range s {
-		if !unicode.IsPrint(r) {
-			return false
+// loadConnOptions 读取 databaseName 的配置；ini 的 Must* 会写回默认值，并发读取须持有 confMu
+func loadConnOptions(databaseName, host, port string) (connOptions, error) {
+	confMu.Lock()
+	defer confMu.Unlock()
+
+	drive := dbConf.Key(databaseName + ".drive").String()
+	o := connOptions{
+		dialect:     drive,
+		addr:        host + ":" + port,
+		path:        dbConf.Key(databaseName + ".path").String(),
+		maxOpen:     dbConf.Key(databaseName + ".max_open").MustInt(defaultMysqlMaxOpen),
+		maxIdle:     dbConf.Key(databaseName + ".max_idle").MustInt(defaultMysqlMaxIdle),
+		maxLifetime: dbConf.Key(databaseName + ".max_lifetime").MustDuration(DefaultMaxLifetime),
+		maxIdleTime: dbConf.Key(databaseName + ".max_idle_time").MustDuration(0),
+		handle: handleOptions{
+			queryTimeout: dbConf.Key(databaseName + ".query_timeout").MustDuration(0),
+		},
+	}
+
+	switch drive {
+	case "mysql":
+		var err error
+		if o.dsn, err = mysqlDSN(loadDSNOptions(databaseName, host, port)); err != nil {
+			return o, &ConfigError{databaseName, err}
+		}
+		// 驱动在连接时才解析 DSN，提前校验 params 等配置
+		if _, err = mysql.ParseDSN(o.dsn); err != nil {
+			return o, &ConfigError{databaseName, err}
+		}
+	case "postgresql", "postgres":
+		o.dialect = "postgres"
+		o.dsn = postgresDSN(loadDSNOptions(databaseName, host, port))
+		if _, err := pq.NewConnector(o.dsn); err != nil {
+			return o, &ConfigError{databaseName, err}
+		}
+	case "sqlite3":
+		if o.path == "" {
+			return o, &ConfigError{databaseName, fmt.Errorf("sqlite3 path is empty")}
 		}
+		o.dsn, o.addr = o.path, o.path
+		// 内存数据库每个连接相互独立，限制为单个常驻连接
+		if o.path == MemoryPath {
+			o.maxOpen, o.maxIdle = 1, 1
+		}
+	default:
+		return o, &ConfigError{databaseName, fmt.Errorf("unknown database drive: %s", drive)}
 	}
-	return true
-}
 
-type gLogger struct {
-	*zap.Logger
+	logModeCfg := config.Section("gorm").Key("log.mode")
+	if logModeCfg.String() != "" {
+		var err error
+		if o.logMode, err = logModeCfg.Bool(); err != nil {
+			return o, &ConfigError{databaseName, err}
+		}
+		o.setLogMode = true
+	}
+
+	var err error
+	if o.logger, err = newGLogger(o.logMode, o.logMode || !o.setLogMode); err != nil {
+		return o, &ConfigError{databaseName, err}
+	}
+	return o, nil
 }
 
-// Print format & print log
-func (l gLogger) Print(values ...interface{}) {
-	if len(values) <= 1 {
-		return
+// openDB 按 databaseName 的配置连接 host:port，主库与从库共用除地址外的配置，ctx 限制连接时的 ping
+func openDB(ctx context.Context, databaseName, host, port string) (*gorm.DB, error) {
+	o, err := loadConnOptions(databaseName, host, port)
+	if err != nil {
+		return nil, err
 	}
 
-	var messages []zap.Field
-	var (
-		sql             string
-		msg             string
-		formattedValues []string
-		level           = values[0].(string)
-		source          = fmt.Sprintf("%v", values[1])
-	)
-
-	if level == "sql" {
-		// duration
-		messages = append(messages, zap.String("elapsed", values[2].(time.Duration).String()))
-
-		// sql
-		for _, value := range values[4].([]interface{}) {
-			indirectValue := reflect.Indirect(reflect.ValueOf(value))
-			if indirectValue.IsValid() {
-				value = indirectValue.Interface()
-				if t, ok := value.(time.Time); ok {
-					if t.IsZero() {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", "0000-00-00 00:00:00"))
-					} else {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", t.Format("2006-01-02 15:04:05")))
-					}
-				} else if b, ok := value.([]byte); ok {
-					if str := string(b); isPrintable(str) {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", str))
-					} else {
-						formattedValues = append(formattedValues, "'<binary>'")
-					}
-				} else if r, ok := value.(driver.Valuer); ok {
-					if value, err := r.Value(); err == nil && value != nil {
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-					} else {
-						formattedValues = append(formattedValues, "NULL")
-					}
-				} else {
-					switch value.(type) {
-					case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
-						formattedValues = append(formattedValues, fmt.Sprintf("%v", value))
-					default:
-						formattedValues = append(formattedValues, fmt.Sprintf("'%v'", value))
-					}
-				}
-			} else {
-				formattedValues = append(formattedValues, "NULL")
-			}
+	// gorm.Open 的 ping 不受 ctx 控制，先以 ctx 建立连接，gorm 随后复用该连接
+	var db *gorm.DB
+	conn, err := sql.Open(driverNames[o.dialect], o.dsn)
+	if err == nil {
+		if err = pingContext(ctx, conn); err == nil {
+			db, err = gorm.Open(o.dialect, conn)
 		}
-
-		// differentiate between $n placeholders or else treat like ?
-		if regexp.MustCompile(`\$\d+`).MatchString(values[3].(string)) {
-			sql = values[3].(string)
-			for index, value := range formattedValues {
-				placeholder := fmt.Sprintf(`\$%d([^\d]|$)`, index+1)
-				sql = regexp.MustCompile(placeholder).ReplaceAllString(sql, value+"$1")
-			}
-		} else {
-			formattedValuesLength := len(formattedValues)
-			for index, value := range regexp.MustCompile(`\?`).Split(values[3].(string), -1) {
-				sql += value
-				if index < formattedValuesLength && formattedValues != nil {
-					sql += formattedValues[index]
-				}
-			}
+		if err != nil {
+			conn.Close()
 		}
-
-		//messages = append(messages, zap.String("sql", sql))
-		messages = append(messages, zap.Int64("rows affected or returned", values[5].(int64)))
-	} else {
-		if strings.HasPrefix(level, "/") {
-			source = values[0].(string)
-			msg = fmt.Sprintf("%v", values[1:])
-		} else {
-			msg = fmt.Sprintf("%v", values[2:])
+	}
+	if err != nil {
+		// 认证失败、库不存在等配置错误不重试
+		if isConfigError(err) {
+			return nil, &ConfigError{databaseName, err}
 		}
+		return nil, &ConnectError{Name: databaseName, Addr: o.addr, Attempts: 1, Err: err}
 	}
 
-	messages = append(messages, zap.String("source", source))
-
-	switch level {
-	case "sql":
-		l.Debug(fmt.Sprintf("[gorm] %s: %s", level, sql), messages...)
-	default:
-		l.Error(fmt.Sprintf("[gorm] %s: %s", level, msg), messages...)
+	// 连接及连接池配置
+	if o.path != MemoryPath {
+		db.DB().SetConnMaxLifetime(o.maxLifetime)
+		db.DB().SetConnMaxIdleTime(o.maxIdleTime)
+	}
+	db.DB().SetMaxOpenConns(o.maxOpen)
+	db.DB().SetMaxIdleConns(o.maxIdle)
+
+	// 慢查询、语句统计依赖 gorm 输出每条 SQL，由 gLogger 按 log.mode 过滤
+	if o.logger.slowThreshold > 0 || o.logger.stats {
+		db.LogMode(true)
+	} else if o.setLogMode {
+		db.LogMode(o.logMode)
 	}
+
+	//var logFile *os.File
+	//fileName := logger.GetPath() + "/" + gormConf.Key("log.file").String()
+	//logFile, err = os.OpenFile(fileName, os.O_RDWR|os.O_APPEND|os.O_CREATE, 0666)
+	//if err != nil {
+	//	panic(err)
+	//}
+	//db.SetLogger(gLogger{log.New(logFile, "", 0)})
+	db.SetLogger(o.logger)
+	poolOptions.Store(db.DB(), o.handle)
+
+	return db, nil
 }
@@ -0,0 +1,138 @@
+package database
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+)
+
+const (
+	DefaultConnectTimeout = 15 * time.Second
+	DefaultTimezone       = "Local"
+)
+
+// dsnOptions 连接参数，主库与从库共用除地址外的全部配置
+type dsnOptions struct {
+	username       string
+	password       string
+	host           string
+	port           string
+	dbName         string
+	charset        string
+	sslMode        string
+	tls            string
+	timezone       string
+	connectTimeout time.Duration
+	readTimeout    time.Duration
+	writeTimeout   time.Duration
+	params         map[string]string
+}
+
+func loadDSNOptions(databaseName, host, port string) dsnOptions {
+	o := dsnOptions{
+		username:       dbConf.Key(databaseName + ".username").String(),
+		password:       dbConf.Key(databaseName + ".password").String(),
+		host:           host,
+		port:           port,
+		dbName:         dbConf.Key(databaseName + ".db").String(),
+		charset:        dbConf.Key(databaseName + ".charset").MustString(DefaultCharset),
+		sslMode:        dbConf.Key(databaseName + ".sslmode").String(),
+		tls:            dbConf.Key(databaseName + ".tls").String(),
+		timezone:       dbConf.Key(databaseName + ".timezone").MustString(DefaultTimezone),
+		connectTimeout: dbConf.Key(databaseName + ".connect_timeout").MustDuration(DefaultConnectTimeout),
+		readTimeout:    dbConf.Key(databaseName + ".read_timeout").MustDuration(0),
+		writeTimeout:   dbConf.Key(databaseName + ".write_timeout").MustDuration(0),
+		params:         map[string]string{},
+	}
+
+	// name.params.xxx = yyy 原样追加至 DSN
+	prefix := databaseName + ".params."
+	for _, key := range dbConf.Keys() {
+		if strings.HasPrefix(key.Name(), prefix) {
+			o.params[strings.TrimPrefix(key.Name(), prefix)] = key.String()
+		}
+	}
+	return o
+}
+
+func mysqlDSN(o dsnOptions) (string, error) {
+	loc, err := time.LoadLocation(o.timezone)
+	if err != nil {
+		return "", err
+	}
+
+	cfg := mysql.NewConfig()
+	cfg.User = o.username
+	cfg.Passwd = o.password
+	cfg.Net = "tcp"
+	cfg.Addr = net.JoinHostPort(o.host, o.port)
+	cfg.DBName = o.dbName
+	cfg.ParseTime = true
+	cfg.Loc = loc
+	cfg.Timeout = o.connectTimeout
+	cfg.ReadTimeout = o.readTimeout
+	cfg.WriteTimeout = o.writeTimeout
+	// true、false、skip-verify、preferred 或通过 mysql.RegisterTLSConfig 注册的名称
+	cfg.TLSConfig = o.tls
+
+	cfg.Params = map[string]string{"charset": o.charset}
+	for k, v := range o.params {
+		cfg.Params[k] = v
+	}
+	return cfg.FormatDSN(), nil
+}
+
+// pgQuote quotes a value of the libpq key=value connection string
+func pgQuote(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// pgSSLMode sslmode 优先，否则由 tls 转换：true、skip-verify 为 require，false 为 disable，其余原样作为 sslmode
+func pgSSLMode(o dsnOptions) string {
+	if o.sslMode != "" {
+		return o.sslMode
+	}
+	switch o.tls {
+	case "":
+		return DefaultSSLMode
+	case "true", "skip-verify":
+		return "require"
+	case "false":
+		return "disable"
+	default:
+		return o.tls
+	}
+}
+
+// postgresDSN read_timeout、write_timeout 不被 lib/pq 支持，被忽略；lib/pq 只接受 UTF8 编码，charset 同样被忽略
+func postgresDSN(o dsnOptions) string {
+	pairs := [][2]string{
+		{"host", o.host},
+		{"port", o.port},
+		{"user", o.username},
+		{"password", o.password},
+		{"dbname", o.dbName},
+		{"sslmode", pgSSLMode(o)},
+	}
+	if o.connectTimeout > 0 {
+		// lib/pq 以秒为单位，至少 1 秒
+		seconds := int((o.connectTimeout + time.Second - 1) / time.Second)
+		pairs = append(pairs, [2]string{"connect_timeout", strconv.Itoa(seconds)})
+	}
+	if o.timezone != "" && o.timezone != DefaultTimezone {
+		pairs = append(pairs, [2]string{"timezone", o.timezone})
+	}
+
+	var b strings.Builder
+	for _, kv := range pairs {
+		fmt.Fprintf(&b, "%s=%s ", kv[0], pgQuote(kv[1]))
+	}
+	for k, v := range o.params {
+		fmt.Fprintf(&b, "%s=%s ", k, pgQuote(v))
+	}
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,105 @@
+package database
+
+import (
+	"testing"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestMysqlDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		o    dsnOptions
+		addr string
+	}{
+		{"plain", dsnOptions{username: "app", password: "secret", host: "db", port: "3306"}, "db:3306"},
+		{"special password", dsnOptions{username: "app", password: `p'a\s@s/w o:rd`, host: "db", port: "3306"}, "db:3306"},
+		{"ipv6", dsnOptions{username: "app", password: "x", host: "::1", port: "3307"}, "[::1]:3307"},
+		{"tls and params", dsnOptions{username: "app", host: "db", port: "3306", tls: "skip-verify",
+			params: map[string]string{"sql_mode": "'STRICT_ALL_TABLES'", "autocommit": "true"}}, "db:3306"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.o.dbName, tt.o.charset, tt.o.timezone = "app_db", "utf8mb4", "UTC"
+			tt.o.connectTimeout = 1500 * time.Millisecond
+			dsn, err := mysqlDSN(tt.o)
+			if err != nil {
+				t.Fatal(err)
+			}
+			cfg, err := mysql.ParseDSN(dsn)
+			if err != nil {
+				t.Fatalf("ParseDSN(%q): %v", dsn, err)
+			}
+			if cfg.User != tt.o.username || cfg.Passwd != tt.o.password || cfg.Addr != tt.addr || cfg.DBName != "app_db" {
+				t.Errorf("%q parsed as user %q password %q addr %q db %q", dsn, cfg.User, cfg.Passwd, cfg.Addr, cfg.DBName)
+			}
+			if cfg.Timeout != tt.o.connectTimeout || cfg.Loc != time.UTC || !cfg.ParseTime {
+				t.Errorf("%q parsed as timeout %v loc %v parseTime %v", dsn, cfg.Timeout, cfg.Loc, cfg.ParseTime)
+			}
+			if cfg.TLSConfig != tt.o.tls {
+				t.Errorf("tls = %q, want %q", cfg.TLSConfig, tt.o.tls)
+			}
+			if cfg.Params["charset"] != "utf8mb4" {
+				t.Errorf("charset = %q", cfg.Params["charset"])
+			}
+			for k, v := range tt.o.params {
+				if cfg.Params[k] != v {
+					t.Errorf("params.%s = %q, want %q", k, cfg.Params[k], v)
+				}
+			}
+		})
+	}
+
+	if _, err := mysqlDSN(dsnOptions{timezone: "Nowhere/City"}); err == nil {
+		t.Error("unknown timezone accepted")
+	}
+}
+
+func TestPostgresDSN(t *testing.T) {
+	tests := []struct {
+		name string
+		o    dsnOptions
+		want string
+	}{
+		{"defaults", dsnOptions{username: "app", password: "secret", host: "db", port: "5432", dbName: "app_db",
+			charset: DefaultCharset, timezone: DefaultTimezone},
+			`host='db' port='5432' user='app' password='secret' dbname='app_db' sslmode='disable'`},
+		{"special password", dsnOptions{username: "app", password: `p'a\s@s/w o:rd`, host: "db", port: "5432"},
+			`host='db' port='5432' user='app' password='p\'a\\s@s/w o:rd' dbname='' sslmode='disable'`},
+		{"ipv6", dsnOptions{host: "::1", port: "5433"},
+			`host='::1' port='5433' user='' password='' dbname='' sslmode='disable'`},
+		{"tls true", dsnOptions{host: "db", port: "5432", tls: "true"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='require'`},
+		{"tls skip-verify", dsnOptions{host: "db", port: "5432", tls: "skip-verify"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='require'`},
+		{"tls false", dsnOptions{host: "db", port: "5432", tls: "false"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable'`},
+		{"tls as sslmode", dsnOptions{host: "db", port: "5432", tls: "verify-full"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='verify-full'`},
+		{"sslmode wins", dsnOptions{host: "db", port: "5432", sslMode: "prefer", tls: "true"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='prefer'`},
+		{"connect_timeout rounds up", dsnOptions{host: "db", port: "5432", connectTimeout: 1500 * time.Millisecond},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable' connect_timeout='2'`},
+		{"connect_timeout at least 1s", dsnOptions{host: "db", port: "5432", connectTimeout: time.Millisecond},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable' connect_timeout='1'`},
+		{"connect_timeout whole seconds", dsnOptions{host: "db", port: "5432", connectTimeout: 3 * time.Second},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable' connect_timeout='3'`},
+		{"timezone, charset ignored", dsnOptions{host: "db", port: "5432", timezone: "Asia/Shanghai", charset: "utf8mb4"},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable' timezone='Asia/Shanghai'`},
+		{"params", dsnOptions{host: "db", port: "5432", params: map[string]string{"application_name": "it's app"}},
+			`host='db' port='5432' user='' password='' dbname='' sslmode='disable' application_name='it\'s app'`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := postgresDSN(tt.o)
+			if got != tt.want {
+				t.Errorf("postgresDSN =\n%s\nwant\n%s", got, tt.want)
+			}
+			if _, err := pq.NewConnector(got); err != nil {
+				t.Errorf("pq rejected %q: %v", got, err)
+			}
+		})
+	}
+}
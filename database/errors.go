@@ -0,0 +1,82 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+// ConfigError 配置错误，重试无法恢复
+type ConfigError struct {
+	Name string
+	Err  error
+}
+
+func (e *ConfigError) Error() string {
+	return fmt.Sprintf("database %s: config: %v", e.Name, e.Err)
+}
+
+func (e *ConfigError) Unwrap() error {
+	return e.Err
+}
+
+// ConnectError 连接或 ping 失败，Attempts 为已尝试次数
+type ConnectError struct {
+	Name     string
+	Addr     string
+	Attempts int
+	Err      error
+}
+
+func (e *ConnectError) Error() string {
+	return fmt.Sprintf("database %s: connect %s failed after %d attempt(s): %v", e.Name, e.Addr, e.Attempts, e.Err)
+}
+
+func (e *ConnectError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	// mysqlConfigErrors 认证失败、库不存在等服务端错误码
+	mysqlConfigErrors = map[uint16]bool{
+		1044: true, // ER_DBACCESS_DENIED_ERROR
+		1045: true, // ER_ACCESS_DENIED_ERROR
+		1049: true, // ER_BAD_DB_ERROR
+		1698: true, // ER_ACCESS_DENIED_NO_PASSWORD_ERROR
+	}
+	postgresConfigErrors = map[pq.ErrorCode]bool{
+		"28000": true, // invalid_authorization_specification
+		"28P01": true, // invalid_password
+		"3D000": true, // invalid_catalog_name
+	}
+	// 客户端认证方式、TLS 配置与服务端不符
+	driverConfigErrors = []error{
+		mysql.ErrCleartextPassword, mysql.ErrNativePassword, mysql.ErrOldPassword, mysql.ErrUnknownPlugin,
+		mysql.ErrNoTLS, pq.ErrSSLNotSupported, pq.ErrSSLKeyHasWorldPermissions,
+	}
+)
+
+// isConfigError reports whether err returned while connecting is caused by the configuration
+// (credentials, database name, driver) rather than the network, so that retrying cannot help
+func isConfigError(err error) bool {
+	if strings.HasPrefix(err.Error(), "sql: unknown driver") {
+		return true
+	}
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return mysqlConfigErrors[myErr.Number]
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return postgresConfigErrors[pqErr.Code]
+	}
+	for _, e := range driverConfigErrors {
+		if errors.Is(err, e) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,32 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/lib/pq"
+)
+
+func TestIsConfigError(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&mysql.MySQLError{Number: 1045, Message: "Access denied"}, true},
+		{&mysql.MySQLError{Number: 1049, Message: "Unknown database"}, true},
+		{&mysql.MySQLError{Number: 1040, Message: "Too many connections"}, false},
+		{&pq.Error{Code: "28P01"}, true},
+		{&pq.Error{Code: "3D000"}, true},
+		{&pq.Error{Code: "57P03"}, false}, // cannot_connect_now
+		{fmt.Errorf("ping: %w", mysql.ErrNativePassword), true},
+		{errors.New("sql: unknown driver \"oracle\""), true},
+		{errors.New("dial tcp 127.0.0.1:3306: connect: connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isConfigError(tt.err); got != tt.want {
+			t.Errorf("isConfigError(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,293 @@
+package database
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	DefaultLockTTL = 30 * time.Second
+	LockTable      = "db_locks"
+
+	lockPollInterval = 100 * time.Millisecond
+	mysqlLockNameMax = 64
+)
+
+var (
+	// ErrLocked is returned by TryLock when the lock is held by another session
+	ErrLocked = errors.New("database: lock is held by another session")
+	// ErrLockTimeout is returned by Lock when ctx is done before the lock is acquired
+	ErrLockTimeout = errors.New("database: lock timeout")
+)
+
+var lockTableOnce sync.Map
+
+// LockHandle is a held lock, released by Unlock, by losing the connection (MySQL, PostgreSQL)
+// or by missing lease renewals for ttl (SQLite)
+type LockHandle struct {
+	name    string
+	dialect string
+	key     interface{}
+	conn    *sql.Conn // MySQL、PostgreSQL 持锁的专用连接
+	db      *sql.DB   // 租约表
+	owner   string
+	ttl     time.Duration
+
+	once sync.Once
+	done chan struct{}
+	lost chan struct{}
+}
+
+// Lock 阻塞直至取得名为 name 的锁或 ctx 结束（返回 ErrLockTimeout）。
+// MySQL 使用 GET_LOCK，PostgreSQL 使用 advisory lock，锁与专用连接绑定，进程退出或连接断开即释放，
+// 持锁期间每 ttl/3 检查连接；其他数据库使用 db_locks 租约表，持锁期间每 ttl/3 续约，持有者失联 ttl 后锁过期。
+// ttl 小于等于 0 时为 DefaultLockTTL
+func Lock(ctx context.Context, db *gorm.DB, name string, ttl time.Duration) (*LockHandle, error) {
+	return acquireLock(ctx, db, name, ttl, true)
+}
+
+// TryLock is like Lock but returns ErrLocked immediately if the lock is held by another session
+func TryLock(ctx context.Context, db *gorm.DB, name string, ttl time.Duration) (*LockHandle, error) {
+	return acquireLock(ctx, db, name, ttl, false)
+}
+
+func acquireLock(ctx context.Context, db *gorm.DB, name string, ttl time.Duration, wait bool) (*LockHandle, error) {
+	// WithContext 绑定的句柄使用其底层连接池，锁的等待由 ctx 控制
+	raw := SQLDB(db)
+	if raw == nil {
+		return nil, fmt.Errorf("database: lock %s: db is a transaction", name)
+	}
+	if ttl <= 0 {
+		ttl = DefaultLockTTL
+	}
+
+	l := &LockHandle{
+		name:    name,
+		dialect: db.Dialect().GetName(),
+		ttl:     ttl,
+		done:    make(chan struct{}),
+		lost:    make(chan struct{}),
+	}
+
+	var err error
+	switch l.dialect {
+	case "mysql":
+		err = l.lockMysql(ctx, raw, wait)
+	case "postgres":
+		err = l.lockPostgres(ctx, raw, wait)
+	default:
+		err = l.lockLease(ctx, raw, wait)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	go l.keepalive()
+	return l, nil
+}
+
+func (l *LockHandle) lockMysql(ctx context.Context, db *sql.DB, wait bool) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	// GET_LOCK 名称最长 64 字符
+	key := l.name
+	if len(key) > mysqlLockNameMax {
+		h := fnv.New64a()
+		h.Write([]byte(key))
+		key = fmt.Sprintf("%s:%x", key[:mysqlLockNameMax-17], h.Sum64())
+	}
+
+	// 无截止时间时无限等待，由 ctx 取消中断
+	timeout := 0
+	if wait {
+		timeout = -1
+		if deadline, ok := ctx.Deadline(); ok {
+			timeout = int(time.Until(deadline) / time.Second)
+		}
+	}
+
+	var got sql.NullInt64
+	err = conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, ?)", key, timeout).Scan(&got)
+	if err == nil && got.Int64 != 1 {
+		err = ErrLocked
+		if wait {
+			err = ErrLockTimeout
+		}
+	} else if err != nil && ctx.Err() != nil {
+		err = ErrLockTimeout
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	l.conn, l.key = conn, key
+	return nil
+}
+
+func (l *LockHandle) lockPostgres(ctx context.Context, db *sql.DB, wait bool) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+
+	h := fnv.New64a()
+	h.Write([]byte(l.name))
+	key := int64(h.Sum64())
+
+	if wait {
+		if _, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", key); err != nil && ctx.Err() != nil {
+			err = ErrLockTimeout
+		}
+	} else {
+		var got bool
+		err = conn.QueryRowContext(ctx, "SELECT pg_try_advisory_lock($1)", key).Scan(&got)
+		if err == nil && !got {
+			err = ErrLocked
+		}
+	}
+	if err != nil {
+		conn.Close()
+		return err
+	}
+
+	l.conn, l.key = conn, key
+	return nil
+}
+
+func (l *LockHandle) lockLease(ctx context.Context, db *sql.DB, wait bool) error {
+	if _, ok := lockTableOnce.Load(db); !ok {
+		_, err := db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+LockTable+
+			" (name VARCHAR(255) PRIMARY KEY, owner VARCHAR(64) NOT NULL, expires_at BIGINT NOT NULL)")
+		if err != nil {
+			return err
+		}
+		lockTableOnce.Store(db, true)
+	}
+
+	owner := make([]byte, 16)
+	if _, err := rand.Read(owner); err != nil {
+		return err
+	}
+	l.db, l.owner = db, hex.EncodeToString(owner)
+
+	for {
+		now := time.Now()
+		// 不存在或已过期时取得锁
+		res, err := db.ExecContext(ctx, "INSERT INTO "+LockTable+" (name, owner, expires_at) VALUES (?, ?, ?)"+
+			" ON CONFLICT (name) DO UPDATE SET owner = excluded.owner, expires_at = excluded.expires_at"+
+			" WHERE "+LockTable+".expires_at < ?", l.name, l.owner, now.Add(l.ttl).UnixNano(), now.UnixNano())
+		if err != nil {
+			if ctx.Err() != nil {
+				return ErrLockTimeout
+			}
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 1 {
+			return nil
+		}
+		if !wait {
+			return ErrLocked
+		}
+
+		select {
+		case <-ctx.Done():
+			return ErrLockTimeout
+		case <-time.After(lockPollInterval):
+		}
+	}
+}
+
+// keepalive 检查持锁连接或续约，失败时锁视为丢失
+func (l *LockHandle) keepalive() {
+	ticker := time.NewTicker(l.ttl / 3)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-l.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl/3)
+		var err error
+		if l.conn != nil {
+			err = l.conn.PingContext(ctx)
+		} else {
+			var res sql.Result
+			res, err = l.db.ExecContext(ctx, "UPDATE "+LockTable+" SET expires_at = ? WHERE name = ? AND owner = ?",
+				time.Now().Add(l.ttl).UnixNano(), l.name, l.owner)
+			if err == nil {
+				if n, _ := res.RowsAffected(); n != 1 {
+					err = errors.New("lease expired")
+				}
+			}
+		}
+		cancel()
+
+		if err != nil {
+			log.Println("[database] lock " + l.name + " lost: " + err.Error())
+			close(l.lost)
+			l.release()
+			return
+		}
+	}
+}
+
+// Name returns the lock name
+func (l *LockHandle) Name() string {
+	return l.name
+}
+
+// Lost is closed when the lock is lost before Unlock, work protected by the lock should stop
+func (l *LockHandle) Lost() <-chan struct{} {
+	return l.lost
+}
+
+// Unlock releases the lock, it is safe to call more than once
+func (l *LockHandle) Unlock() error {
+	return l.release()
+}
+
+func (l *LockHandle) release() error {
+	var err error
+	l.once.Do(func() {
+		close(l.done)
+
+		ctx, cancel := context.WithTimeout(context.Background(), l.ttl)
+		defer cancel()
+		switch {
+		case l.conn != nil:
+			if l.dialect == "mysql" {
+				_, err = l.conn.ExecContext(ctx, "SELECT RELEASE_LOCK(?)", l.key)
+			} else {
+				_, err = l.conn.ExecContext(ctx, "SELECT pg_advisory_unlock($1)", l.key)
+			}
+			// 释放失败时丢弃连接，断开后服务端释放锁，避免连接带锁回到连接池
+			if err != nil {
+				l.conn.Raw(func(interface{}) error { return driver.ErrBadConn })
+			}
+			if e := l.conn.Close(); err == nil {
+				err = e
+			}
+		default:
+			_, err = l.db.ExecContext(ctx, "DELETE FROM "+LockTable+" WHERE name = ? AND owner = ?", l.name, l.owner)
+		}
+	})
+	return err
+}
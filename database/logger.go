@@ -0,0 +1,171 @@
+package database
+
+import (
+	"database/sql/driver"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/logger"
+	"go.uber.org/zap"
+)
+
+var (
+	numericPlaceholderRegexp = regexp.MustCompile(`\$\d+`)
+	whitespaceRegexp         = regexp.MustCompile(`\s+`)
+)
+
+func isPrintable(s string) bool {
+	for _, r := range s {
+		if !unicode.IsPrint(r) {
+			return false
+		}
+	}
+	return true
+}
+
+type gLogger struct {
+	*zap.Logger
+	logSQL        bool
+	logErrors     bool
+	slowThreshold time.Duration
+	stats         bool
+	values        valuePolicy
+}
+
+// newGLogger logSQL 为 [gorm] log.mode，logErrors 在 log.mode = false 时为 false，与 gorm 的 LogMode(false) 一致不记录错误；
+// slow_threshold 大于 0 时超出阈值的语句以 Warn 级别记录，stats 为 true 时按 fingerprint 统计每条语句，参数按 valuePolicy 输出。
+// 慢查询、统计需要 gorm 以 LogMode(true) 输出每条语句，log.mode 的取舍由 gLogger 完成
+func newGLogger(logSQL, logErrors bool) (gLogger, error) {
+	values, err := newValuePolicy()
+	if err != nil {
+		return gLogger{}, err
+	}
+	return gLogger{
+		Logger:        logger.NewLogger(config.AppName + "-gorm"),
+		logSQL:        logSQL,
+		logErrors:     logErrors,
+		slowThreshold: config.Section("gorm").Key("slow_threshold").MustDuration(0),
+		stats:         config.Section("gorm").Key("stats").MustBool(false),
+		values:        values,
+	}, nil
+}
+
+// Print format & print log
+func (l gLogger) Print(values ...interface{}) {
+	if len(values) <= 1 {
+		return
+	}
+
+	var (
+		level  = values[0].(string)
+		source = fmt.Sprintf("%v", values[1])
+	)
+
+	if level != "sql" {
+		if !l.logErrors {
+			return
+		}
+		var msg string
+		if strings.HasPrefix(level, "/") {
+			source = values[0].(string)
+			msg = fmt.Sprintf("%v", values[1:])
+		} else {
+			msg = fmt.Sprintf("%v", values[2:])
+		}
+		if err, ok := values[len(values)-1].(error); ok && isCancelled(err) {
+			l.Warn(fmt.Sprintf("[gorm] cancelled: %s", msg), zap.String("source", source), zap.Error(err))
+			return
+		}
+		l.Error(fmt.Sprintf("[gorm] %s: %s", level, msg), zap.String("source", source))
+		return
+	}
+
+	elapsed := values[2].(time.Duration)
+	statement := values[3].(string)
+	if l.stats {
+		recordQuery(statement, elapsed, values[5].(int64))
+	}
+
+	slow := l.slowThreshold > 0 && elapsed >= l.slowThreshold
+	if !slow && !l.logSQL {
+		return
+	}
+
+	fields := []zap.Field{
+		zap.String("sql", l.values.formatSQL(statement, values[4].([]interface{}))),
+		zap.Duration("duration", elapsed),
+		zap.Int64("rows", values[5].(int64)),
+		zap.String("source", source),
+	}
+
+	if slow {
+		fields = append(fields, zap.String("normalized", normalizeSQL(statement)))
+		l.Warn("[gorm] slow sql", fields...)
+	} else {
+		l.Debug("[gorm] sql", fields...)
+	}
+}
+
+// normalizeSQL 返回未代入参数、空白折叠后的语句，相同语句可据此聚合
+func normalizeSQL(statement string) string {
+	return strings.TrimSpace(whitespaceRegexp.ReplaceAllString(statement, " "))
+}
+
+func formatValue(value interface{}) string {
+	indirectValue := reflect.Indirect(reflect.ValueOf(value))
+	if !indirectValue.IsValid() {
+		return "NULL"
+	}
+
+	value = indirectValue.Interface()
+	if t, ok := value.(time.Time); ok {
+		if t.IsZero() {
+			return fmt.Sprintf("'%v'", "0000-00-00 00:00:00")
+		}
+		return fmt.Sprintf("'%v'", t.Format("2006-01-02 15:04:05"))
+	} else if b, ok := value.([]byte); ok {
+		if str := string(b); isPrintable(str) {
+			return fmt.Sprintf("'%v'", str)
+		}
+		return "'<binary>'"
+	} else if r, ok := value.(driver.Valuer); ok {
+		if value, err := r.Value(); err == nil && value != nil {
+			return fmt.Sprintf("'%v'", value)
+		}
+		return "NULL"
+	}
+
+	switch value.(type) {
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64, float32, float64, bool:
+		return fmt.Sprintf("%v", value)
+	default:
+		return fmt.Sprintf("'%v'", value)
+	}
+}
+
+// formatSQL 将已格式化的参数代入语句
+func formatSQL(statement string, formattedValues []string) string {
+	// differentiate between $n placeholders or else treat like ?
+	var sql string
+	if numericPlaceholderRegexp.MatchString(statement) {
+		sql = statement
+		for index, value := range formattedValues {
+			placeholder := fmt.Sprintf(`\$%d([^\d]|$)`, index+1)
+			sql = regexp.MustCompile(placeholder).ReplaceAllString(sql, value+"$1")
+		}
+	} else {
+		formattedValuesLength := len(formattedValues)
+		for index, value := range strings.Split(statement, "?") {
+			sql += value
+			if index < formattedValuesLength {
+				sql += formattedValues[index]
+			}
+		}
+	}
+	return sql
+}
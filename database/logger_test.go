@@ -0,0 +1,51 @@
+package database
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestGLoggerLogMode(t *testing.T) {
+	sql := func(elapsed time.Duration) []interface{} {
+		return []interface{}{"sql", "file.go:1", elapsed, "SELECT 1", []interface{}{}, int64(1)}
+	}
+	tests := []struct {
+		name              string
+		logSQL, logErrors bool
+		want              []string
+	}{
+		// log.mode = true
+		{"true", true, true, []string{"[gorm] error: [boom]", "[gorm] sql", "[gorm] slow sql"}},
+		// log.mode 为空，只记录错误，慢查询由 slow_threshold 控制
+		{"empty", false, true, []string{"[gorm] error: [boom]", "[gorm] slow sql"}},
+		// log.mode = false，gorm 因慢查询打开 LogMode 时仍不记录错误
+		{"false", false, false, []string{"[gorm] slow sql"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			core, logs := observer.New(zapcore.DebugLevel)
+			l := gLogger{Logger: zap.New(core), logSQL: tt.logSQL, logErrors: tt.logErrors, slowThreshold: time.Second}
+			l.Print("error", "file.go:1", errors.New("boom"))
+			l.Print(sql(time.Millisecond)...)
+			l.Print(sql(2 * time.Second)...)
+
+			var got []string
+			for _, e := range logs.All() {
+				got = append(got, e.Message)
+			}
+			if len(got) != len(tt.want) {
+				t.Fatalf("logged %q, want %q", got, tt.want)
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("logged %q, want %q", got, tt.want)
+				}
+			}
+		})
+	}
+}
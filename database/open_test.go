@@ -0,0 +1,60 @@
+package database
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+// TestOpenDeadline 连接建立后不响应的服务端，ping 受 retry_deadline 限制，且不阻塞其他句柄的 Open
+func TestOpenDeadline(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	host, port, _ := net.SplitHostPort(ln.Addr().String())
+	section := config.Section("database")
+	for key, value := range map[string]string{
+		"hang.drive": "postgres", "hang.host": host, "hang.port": port,
+		"hang.retry_attempts": "10", "hang.retry_deadline": "300ms",
+	} {
+		section.Key(key).SetValue(value)
+	}
+
+	done := make(chan error, 1)
+	start := time.Now()
+	go func() {
+		_, err := Open("hang")
+		done <- err
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	if _, err := Open("test"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 250*time.Millisecond {
+		t.Errorf("Open(test) waited %v for another handle", elapsed)
+	}
+
+	select {
+	case err := <-done:
+		if _, ok := err.(*ConnectError); !ok {
+			t.Errorf("Open(hang) err = %v", err)
+		}
+	case <-time.After(3 * time.Second):
+		t.Fatal("Open(hang) ignored retry_deadline")
+	}
+}
@@ -0,0 +1,377 @@
+package database
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/config"
+)
+
+const (
+	DefaultPageSize = 20
+	DefaultMaxSize  = 100
+)
+
+// ErrInvalidCursor is returned for cursors that are malformed, forged or issued for another ordering
+var ErrInvalidCursor = errors.New("database: invalid cursor")
+
+var (
+	defaultPageSize = DefaultPageSize
+	maxPageSize     = DefaultMaxSize
+	cursorSecret    []byte
+	secretOnce      sync.Once
+)
+
+func init() {
+	conf := config.Section("pagination")
+	defaultPageSize = conf.Key("default_size").MustInt(DefaultPageSize)
+	maxPageSize = conf.Key("max_size").MustInt(DefaultMaxSize)
+
+	cursorSecret = []byte(conf.Key("secret").String())
+}
+
+// randomSecret 未配置密钥时在首次使用游标时随机生成并告警，游标仅在当前进程内有效，多实例部署须配置相同的密钥
+func randomSecret() {
+	if len(cursorSecret) > 0 {
+		return
+	}
+	log.Println("[database] [pagination] secret is not set, cursors are signed with a random key and " +
+		"rejected by other instances or after restart")
+	cursorSecret = make([]byte, 32)
+	if _, err := rand.Read(cursorSecret); err != nil {
+		log.Println("[database] pagination secret: " + err.Error())
+	}
+}
+
+// pageSize bounds size to [1, max_size], 0 or negative means default_size
+func pageSize(size int) int {
+	if size <= 0 {
+		return defaultPageSize
+	}
+	if size > maxPageSize {
+		return maxPageSize
+	}
+	return size
+}
+
+// Page is the result of Paginate, Items is the dest passed in
+type Page struct {
+	Items interface{} `json:"items"`
+	Page  int         `json:"page"`
+	Size  int         `json:"size"`
+	Total int64       `json:"total"`
+	Pages int         `json:"pages"`
+}
+
+// Paginate 按页码分页，查询总数后将第 page 页（从 1 开始）的记录写入 dest（切片指针）
+//
+//	var users []User
+//	p, err := database.Paginate(db.Where("status = ?", 1).Order("id desc"), page, size, &users)
+func Paginate(query *gorm.DB, page, size int, dest interface{}) (*Page, error) {
+	if page < 1 {
+		page = 1
+	}
+	size = pageSize(size)
+
+	p := &Page{Items: dest, Page: page, Size: size}
+	if err := query.Model(dest).Limit(-1).Offset(-1).Count(&p.Total).Error; err != nil {
+		return nil, err
+	}
+	p.Pages = int((p.Total + int64(size) - 1) / int64(size))
+
+	if p.Total > int64(page-1)*int64(size) {
+		if err := query.Limit(size).Offset((page - 1) * size).Find(dest).Error; err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// OrderColumn is a column of the keyset ordering, the columns together must be unique and not null
+type OrderColumn struct {
+	Name string
+	Desc bool
+}
+
+// Asc orders by name ascending
+func Asc(name string) OrderColumn {
+	return OrderColumn{Name: name}
+}
+
+// Desc orders by name descending
+func Desc(name string) OrderColumn {
+	return OrderColumn{Name: name, Desc: true}
+}
+
+// CursorPage is the result of PaginateCursor, Next is empty on the last page
+type CursorPage struct {
+	Items   interface{} `json:"items"`
+	Size    int         `json:"size"`
+	Next    string      `json:"next,omitempty"`
+	HasMore bool        `json:"has_more"`
+}
+
+// PaginateCursor 按 columns 游标分页，cursor 为上一页返回的 Next，首页传空，
+// 游标以 [pagination] secret 签名，排序列不同的游标视为无效
+//
+//	var users []User
+//	p, err := database.PaginateCursor(db, cursor, size, &users, database.Desc("created_at"), database.Desc("id"))
+func PaginateCursor(query *gorm.DB, cursor string, size int, dest interface{}, columns ...OrderColumn) (*CursorPage, error) {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return nil, fmt.Errorf("database: PaginateCursor dest must be a pointer to slice, got %T", dest)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("database: PaginateCursor needs at least one column")
+	}
+	size = pageSize(size)
+
+	if cursor != "" {
+		values, err := decodeCursor(cursor, columns)
+		if err != nil {
+			return nil, err
+		}
+		where, args := keysetCondition(query, columns, values)
+		query = query.Where(where, args...)
+	}
+	for _, c := range columns {
+		order := quoteColumn(query, c.Name)
+		if c.Desc {
+			order += " DESC"
+		}
+		query = query.Order(order)
+	}
+
+	// 多取一条以判断是否有下一页
+	if err := query.Limit(size + 1).Find(dest).Error; err != nil {
+		return nil, err
+	}
+
+	p := &CursorPage{Items: dest, Size: size}
+	rows := destValue.Elem()
+	if rows.Len() <= size {
+		return p, nil
+	}
+	rows.Set(rows.Slice(0, size))
+	p.HasMore = true
+
+	last := rows.Index(size - 1)
+	if last.Kind() != reflect.Ptr {
+		last = last.Addr()
+	}
+	scope := query.NewScope(last.Interface())
+	values := make([]interface{}, len(columns))
+	for i, c := range columns {
+		name := c.Name
+		if i := strings.LastIndex(name, "."); i >= 0 {
+			name = name[i+1:]
+		}
+		field, ok := scope.FieldByName(name)
+		if !ok {
+			return nil, fmt.Errorf("database: PaginateCursor column %s not found in %s", c.Name, last.Type())
+		}
+		values[i] = field.Field.Interface()
+	}
+
+	var err error
+	if p.Next, err = encodeCursor(columns, values); err != nil {
+		return nil, err
+	}
+	return p, nil
+}
+
+func quoteColumn(query *gorm.DB, name string) string {
+	parts := strings.Split(name, ".")
+	for i, part := range parts {
+		parts[i] = query.Dialect().Quote(part)
+	}
+	return strings.Join(parts, ".")
+}
+
+// keysetCondition 展开为 (a > ?) OR (a = ? AND b < ?) ...，兼容不支持行比较的数据库及混合排序方向
+func keysetCondition(query *gorm.DB, columns []OrderColumn, values []interface{}) (string, []interface{}) {
+	var (
+		ors  []string
+		args []interface{}
+	)
+	for i, c := range columns {
+		var ands []string
+		for j := 0; j < i; j++ {
+			ands = append(ands, quoteColumn(query, columns[j].Name)+" = ?")
+			args = append(args, values[j])
+		}
+		op := " > ?"
+		if c.Desc {
+			op = " < ?"
+		}
+		ands = append(ands, quoteColumn(query, c.Name)+op)
+		args = append(args, values[i])
+		ors = append(ors, "("+strings.Join(ands, " AND ")+")")
+	}
+	return "(" + strings.Join(ors, " OR ") + ")", args
+}
+
+// cursorValue 记录值的类型，解码后按原类型绑定参数
+type cursorValue struct {
+	T string `json:"t"`
+	V string `json:"v"`
+}
+
+type cursorPayload struct {
+	Columns string        `json:"c"`
+	Values  []cursorValue `json:"v"`
+}
+
+func columnsKey(columns []OrderColumn) string {
+	keys := make([]string, len(columns))
+	for i, c := range columns {
+		keys[i] = c.Name
+		if c.Desc {
+			keys[i] += " desc"
+		}
+	}
+	return strings.Join(keys, ",")
+}
+
+func encodeValue(v interface{}) (cursorValue, error) {
+	if valuer, ok := v.(driver.Valuer); ok {
+		dv, err := valuer.Value()
+		if err != nil {
+			return cursorValue{}, err
+		}
+		v = dv
+	}
+	if t, ok := v.(time.Time); ok {
+		return cursorValue{"t", t.Format(time.RFC3339Nano)}, nil
+	}
+
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr && !rv.IsNil() {
+		rv = rv.Elem()
+	}
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return cursorValue{"i", strconv.FormatInt(rv.Int(), 10)}, nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return cursorValue{"u", strconv.FormatUint(rv.Uint(), 10)}, nil
+	case reflect.Float32, reflect.Float64:
+		return cursorValue{"f", strconv.FormatFloat(rv.Float(), 'g', -1, 64)}, nil
+	case reflect.Bool:
+		return cursorValue{"b", strconv.FormatBool(rv.Bool())}, nil
+	case reflect.String:
+		return cursorValue{"s", rv.String()}, nil
+	case reflect.Struct:
+		if t, ok := rv.Interface().(time.Time); ok {
+			return cursorValue{"t", t.Format(time.RFC3339Nano)}, nil
+		}
+	}
+	return cursorValue{}, fmt.Errorf("database: unsupported cursor value %T", v)
+}
+
+func decodeValue(v cursorValue) (interface{}, error) {
+	switch v.T {
+	case "i":
+		return strconv.ParseInt(v.V, 10, 64)
+	case "u":
+		return strconv.ParseUint(v.V, 10, 64)
+	case "f":
+		return strconv.ParseFloat(v.V, 64)
+	case "b":
+		return strconv.ParseBool(v.V)
+	case "s":
+		return v.V, nil
+	case "t":
+		return time.Parse(time.RFC3339Nano, v.V)
+	}
+	return nil, fmt.Errorf("unknown type %q", v.T)
+}
+
+func signCursor(payload []byte) []byte {
+	secretOnce.Do(randomSecret)
+	mac := hmac.New(sha256.New, cursorSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
+
+// encodeCursor returns base64(payload).base64(hmac)
+func encodeCursor(columns []OrderColumn, values []interface{}) (string, error) {
+	p := cursorPayload{Columns: columnsKey(columns)}
+	for _, v := range values {
+		cv, err := encodeValue(v)
+		if err != nil {
+			return "", err
+		}
+		p.Values = append(p.Values, cv)
+	}
+
+	payload, err := json.Marshal(p)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(payload) + "." + base64.RawURLEncoding.EncodeToString(signCursor(payload)), nil
+}
+
+func decodeCursor(cursor string, columns []OrderColumn) ([]interface{}, error) {
+	parts := strings.SplitN(cursor, ".", 2)
+	if len(parts) != 2 {
+		return nil, ErrInvalidCursor
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	sig, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil || !hmac.Equal(sig, signCursor(payload)) {
+		return nil, ErrInvalidCursor
+	}
+
+	var p cursorPayload
+	if err := json.Unmarshal(payload, &p); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if p.Columns != columnsKey(columns) || len(p.Values) != len(columns) {
+		return nil, ErrInvalidCursor
+	}
+
+	values := make([]interface{}, len(p.Values))
+	for i, cv := range p.Values {
+		if values[i], err = decodeValue(cv); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return values, nil
+}
+
+// PageQuery holds the page, size and cursor query params
+type PageQuery struct {
+	Page   int    `form:"page" json:"page"`
+	Size   int    `form:"size" json:"size"`
+	Cursor string `form:"cursor" json:"cursor"`
+}
+
+// BindPage 读取 ?page=&size=&cursor= 并限制在有效范围内
+func BindPage(c *gin.Context) (PageQuery, error) {
+	var q PageQuery
+	if err := c.ShouldBindQuery(&q); err != nil {
+		return q, err
+	}
+	if q.Page < 1 {
+		q.Page = 1
+	}
+	q.Size = pageSize(q.Size)
+	return q, nil
+}
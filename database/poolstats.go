@@ -0,0 +1,124 @@
+package database
+
+import (
+	"database/sql"
+	"io"
+	"sort"
+	"sync/atomic"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/metrics"
+)
+
+const (
+	RolePrimary = "primary"
+	RoleReplica = "replica"
+)
+
+// PoolStat 连接池状态，Name 为 [database] 配置名
+type PoolStat struct {
+	Name              string  `json:"name"`
+	Role              string  `json:"role"`
+	Addr              string  `json:"addr,omitempty"`
+	Healthy           bool    `json:"healthy"`
+	MaxOpen           int     `json:"max_open"`
+	Open              int     `json:"open"`
+	InUse             int     `json:"in_use"`
+	Idle              int     `json:"idle"`
+	WaitCount         int64   `json:"wait_count"`
+	WaitDuration      float64 `json:"wait_duration_seconds"`
+	MaxIdleClosed     int64   `json:"max_idle_closed"`
+	MaxLifetimeClosed int64   `json:"max_lifetime_closed"`
+}
+
+func init() {
+	metrics.Register("database", collectPoolStats)
+	metrics.RegisterJSON("database", func() interface{} {
+		return PoolStats()
+	})
+}
+
+func newPoolStat(name, role, addr string, healthy bool, db *gorm.DB) PoolStat {
+	var s sql.DBStats
+	if db != nil {
+		s = db.DB().Stats()
+	}
+	return PoolStat{
+		Name:              name,
+		Role:              role,
+		Addr:              addr,
+		Healthy:           healthy,
+		MaxOpen:           s.MaxOpenConnections,
+		Open:              s.OpenConnections,
+		InUse:             s.InUse,
+		Idle:              s.Idle,
+		WaitCount:         s.WaitCount,
+		WaitDuration:      s.WaitDuration.Seconds(),
+		MaxIdleClosed:     s.MaxIdleClosed,
+		MaxLifetimeClosed: s.MaxLifetimeClosed,
+	}
+}
+
+// PoolStats returns the pool state of every handle opened by Open and NewCluster, ordered by name
+func PoolStats() []PoolStat {
+	var list []PoolStat
+	dbMap.Range(func(key, value interface{}) bool {
+		list = append(list, newPoolStat(key.(string), RolePrimary, "", true, value.(*gorm.DB)))
+		return true
+	})
+	clusterMap.Range(func(key, value interface{}) bool {
+		c := value.(*Cluster)
+		// c.mu 只在替换连接时短暂持有，健康检查重连期间不持有
+		for _, r := range c.replicas {
+			list = append(list, newPoolStat(c.name, RoleReplica, r.addr, atomic.LoadInt32(&r.healthy) == 1, c.replicaDB(r)))
+		}
+		return true
+	})
+
+	sort.SliceStable(list, func(i, j int) bool {
+		if list[i].Name != list[j].Name {
+			return list[i].Name < list[j].Name
+		}
+		return list[i].Role < list[j].Role
+	})
+	return list
+}
+
+func collectPoolStats(w io.Writer) {
+	list := PoolStats()
+	gauges := []struct {
+		name, typ, help string
+		value           func(s PoolStat) float64
+	}{
+		{"db_pool_max_open_connections", "gauge", "Maximum number of open connections to the database.",
+			func(s PoolStat) float64 { return float64(s.MaxOpen) }},
+		{"db_pool_open_connections", "gauge", "Established connections both in use and idle.",
+			func(s PoolStat) float64 { return float64(s.Open) }},
+		{"db_pool_in_use_connections", "gauge", "Connections currently in use.",
+			func(s PoolStat) float64 { return float64(s.InUse) }},
+		{"db_pool_idle_connections", "gauge", "Idle connections.",
+			func(s PoolStat) float64 { return float64(s.Idle) }},
+		{"db_pool_wait_count_total", "counter", "Total number of connections waited for.",
+			func(s PoolStat) float64 { return float64(s.WaitCount) }},
+		{"db_pool_wait_duration_seconds_total", "counter", "Total time blocked waiting for a new connection.",
+			func(s PoolStat) float64 { return s.WaitDuration }},
+		{"db_pool_max_idle_closed_total", "counter", "Connections closed due to max idle.",
+			func(s PoolStat) float64 { return float64(s.MaxIdleClosed) }},
+		{"db_pool_max_lifetime_closed_total", "counter", "Connections closed due to max lifetime.",
+			func(s PoolStat) float64 { return float64(s.MaxLifetimeClosed) }},
+		{"db_pool_healthy", "gauge", "Whether the handle is in rotation, replicas are ejected when pings fail.",
+			func(s PoolStat) float64 {
+				if s.Healthy {
+					return 1
+				}
+				return 0
+			}},
+	}
+
+	for _, g := range gauges {
+		metrics.WriteHeader(w, g.name, g.typ, g.help)
+		for _, s := range list {
+			metrics.WriteSample(w, g.name, g.value(s), "name", s.Name, "role", s.Role, "addr", s.Addr)
+		}
+	}
+}
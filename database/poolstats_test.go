@@ -0,0 +1,66 @@
+package database
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+// TestPoolStatsDuringReconnect 健康检查重连不响应的从库时，PoolStats 不被阻塞
+func TestPoolStatsDuringReconnect(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	accepted := make(chan struct{}, 1)
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+			select {
+			case accepted <- struct{}{}:
+			default:
+			}
+		}
+	}()
+
+	section := config.Section("database")
+	for key, value := range map[string]string{"stall.drive": "postgres", "stall.connect_timeout": "2s"} {
+		section.Key(key).SetValue(value)
+	}
+	c := &Cluster{name: "stall", replicas: []*replica{{addr: ln.Addr().String()}}, done: make(chan struct{})}
+	clusterMap.Store(c.name, c)
+	defer c.Close()
+	go c.check(time.Millisecond, time.Second)
+
+	select {
+	case <-accepted:
+	case <-time.After(time.Second):
+		t.Fatal("replica was not reconnected")
+	}
+
+	done := make(chan []PoolStat, 1)
+	go func() {
+		done <- PoolStats()
+	}()
+	select {
+	case list := <-done:
+		found := false
+		for _, s := range list {
+			if s.Name == "stall" && s.Role == RoleReplica {
+				found = !s.Healthy
+			}
+		}
+		if !found {
+			t.Errorf("PoolStats = %+v, want an unhealthy stall replica", list)
+		}
+	case <-time.After(500 * time.Millisecond):
+		t.Fatal("PoolStats blocked by the reconnect")
+	}
+}
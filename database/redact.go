@@ -0,0 +1,184 @@
+package database
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+const (
+	LogValuesFull     = "full"
+	LogValuesRedacted = "redacted"
+	LogValuesNone     = "none"
+
+	redactedValue = "'<redacted>'"
+	// 向前查找列名的范围，避免长 IN 列表逐个匹配整条语句
+	maxPrefixLength = 128
+)
+
+// DefaultDenyColumns 列名与其中任一项匹配时参数不写入日志，支持 path.Match 通配符
+var DefaultDenyColumns = []string{"*password*", "*passwd*", "*secret*", "*token*", "api_key", "apikey", "private_key"}
+
+var (
+	bindVarRegexp      = regexp.MustCompile(`\?|\$\d+`)
+	insertColumnRegexp = regexp.MustCompile(`(?is)^\s*insert\s+(?:ignore\s+)?into\s+[^\s(]+\s*\(([^)]*)\)\s*values\s*`)
+	// 占位符前的 col =、col <>、col like、col in (
+	comparisonRegexp = regexp.MustCompile("(?i)([\\w`\"]+)\\s*(?:=|<>|!=|<=|>=|<|>|\\slike|\\sin\\s*\\()\\s*$")
+	listItemRegexp   = regexp.MustCompile(`,\s*$`)
+)
+
+// valuePolicy 日志中 SQL 参数的输出策略，由 [gorm] log.values、log.deny_columns、log.max_value_length 配置：
+// full 代入全部参数，redacted 只代入数字、布尔及 NULL，none 不代入；任何模式下 deny 列的参数均不输出
+type valuePolicy struct {
+	mode      string
+	deny      []string
+	maxLength int
+}
+
+// newValuePolicy log.values 不是 full、redacted、none 之一时返回错误，避免拼写错误导致参数全部写入日志
+func newValuePolicy() (valuePolicy, error) {
+	gormConf := config.Section("gorm")
+	p := valuePolicy{
+		mode:      strings.ToLower(gormConf.Key("log.values").MustString(LogValuesFull)),
+		deny:      DefaultDenyColumns,
+		maxLength: gormConf.Key("log.max_value_length").MustInt(0),
+	}
+	switch p.mode {
+	case LogValuesFull, LogValuesRedacted, LogValuesNone:
+	default:
+		return p, fmt.Errorf("unknown [gorm] log.values: %s", p.mode)
+	}
+
+	if gormConf.HasKey("log.deny_columns") {
+		p.deny = nil
+		for _, c := range gormConf.Key("log.deny_columns").Strings(",") {
+			p.deny = append(p.deny, strings.ToLower(strings.Trim(c, "`\"")))
+		}
+	}
+	for _, d := range p.deny {
+		if _, err := path.Match(d, ""); err != nil {
+			return p, fmt.Errorf("invalid [gorm] log.deny_columns pattern %q: %v", d, err)
+		}
+	}
+	return p, nil
+}
+
+// denied 按完整列名（去除引号、表名前缀，不区分大小写）匹配
+func (p valuePolicy) denied(column string) bool {
+	column = strings.Trim(column, "`\"")
+	if i := strings.LastIndex(column, "."); i >= 0 {
+		column = strings.Trim(column[i+1:], "`\"")
+	}
+	column = strings.ToLower(column)
+	for _, d := range p.deny {
+		if ok, _ := path.Match(d, column); ok && d != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// truncate 截断超过 maxLength 的参数，保留引号
+func (p valuePolicy) truncate(value string) string {
+	if p.maxLength <= 0 || len(value) <= p.maxLength+2 {
+		return value
+	}
+	quoted := strings.HasPrefix(value, "'")
+	cut := p.maxLength
+	if quoted {
+		cut++
+	}
+	for cut > 0 && !utf8.RuneStart(value[cut]) {
+		cut--
+	}
+	s := value[:cut] + "...(" + strconv.Itoa(len(value)) + " bytes)"
+	if quoted {
+		s += "'"
+	}
+	return s
+}
+
+// formatSQL 按策略将参数代入语句
+func (p valuePolicy) formatSQL(statement string, values []interface{}) string {
+	if p.mode == LogValuesNone || len(values) == 0 {
+		return statement
+	}
+
+	columns := placeholderColumns(statement, len(values))
+	formattedValues := make([]string, len(values))
+	for i, value := range values {
+		if columns[i] != "" && p.denied(columns[i]) {
+			formattedValues[i] = redactedValue
+			continue
+		}
+		v := formatValue(value)
+		if p.mode == LogValuesRedacted && strings.HasPrefix(v, "'") {
+			formattedValues[i] = redactedValue
+			continue
+		}
+		formattedValues[i] = p.truncate(v)
+	}
+	return formatSQL(statement, formattedValues)
+}
+
+// placeholderColumns 推断每个参数对应的列名：INSERT 按列清单，其余按占位符前的比较表达式，无法判断时为空
+func placeholderColumns(statement string, n int) []string {
+	columns := make([]string, n)
+
+	var (
+		insertColumns []string
+		valuesStart   = -1
+	)
+	if m := insertColumnRegexp.FindStringSubmatchIndex(statement); m != nil {
+		for _, c := range strings.Split(statement[m[2]:m[3]], ",") {
+			insertColumns = append(insertColumns, strings.TrimSpace(c))
+		}
+		valuesStart = m[1]
+	}
+
+	var (
+		last       string
+		seq, inRow int
+	)
+	for _, loc := range bindVarRegexp.FindAllStringIndex(statement, -1) {
+		idx := seq
+		if statement[loc[0]] == '$' {
+			idx, _ = strconv.Atoi(statement[loc[0]+1 : loc[1]])
+			idx--
+		}
+		seq++
+		if idx < 0 || idx >= n {
+			continue
+		}
+
+		var column string
+		if valuesStart >= 0 && loc[0] >= valuesStart && inRow < len(insertColumns)*n {
+			column = insertColumns[inRow%len(insertColumns)]
+			inRow++
+		} else {
+			start := loc[0] - maxPrefixLength
+			if start < 0 {
+				start = 0
+			}
+			prefix := statement[start:loc[0]]
+			if m := comparisonRegexp.FindStringSubmatch(prefix); m != nil {
+				column = m[1]
+			} else if listItemRegexp.MatchString(prefix) {
+				// IN (?, ?, ?) 沿用上一个参数的列
+				column = last
+			}
+		}
+		column = strings.Trim(column, "`\"")
+		if i := strings.LastIndex(column, "."); i >= 0 {
+			column = strings.Trim(column[i+1:], "`\"")
+		}
+		columns[idx] = column
+		last = column
+	}
+	return columns
+}
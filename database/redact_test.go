@@ -0,0 +1,87 @@
+package database
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+func TestPlaceholderColumns(t *testing.T) {
+	tests := []struct {
+		statement string
+		n         int
+		want      []string
+	}{
+		{"SELECT * FROM users WHERE name = ? AND `users`.`password` = ?", 2, []string{"name", "password"}},
+		{"SELECT * FROM users WHERE age >= ? AND email LIKE ?", 2, []string{"age", "email"}},
+		{"SELECT * FROM users WHERE id IN (?, ?, ?)", 3, []string{"id", "id", "id"}},
+		{"INSERT INTO users (name, token) VALUES (?, ?), (?, ?)", 4, []string{"name", "token", "name", "token"}},
+		{`UPDATE "users" SET "secret" = $2 WHERE "id" = $1`, 2, []string{"id", "secret"}},
+		{"SELECT * FROM users LIMIT ?", 1, []string{""}},
+	}
+	for _, tt := range tests {
+		if got := placeholderColumns(tt.statement, tt.n); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("placeholderColumns(%q) = %q, want %q", tt.statement, got, tt.want)
+		}
+	}
+}
+
+func TestValuePolicyFormatSQL(t *testing.T) {
+	statement := "SELECT * FROM users WHERE name = ? AND password = ? AND age = ?"
+	values := []interface{}{"alice", "hunter2", 30}
+
+	tests := []struct {
+		policy valuePolicy
+		want   string
+	}{
+		{valuePolicy{mode: LogValuesFull, deny: DefaultDenyColumns},
+			"SELECT * FROM users WHERE name = 'alice' AND password = '<redacted>' AND age = 30"},
+		{valuePolicy{mode: LogValuesFull},
+			"SELECT * FROM users WHERE name = 'alice' AND password = 'hunter2' AND age = 30"},
+		{valuePolicy{mode: LogValuesRedacted, deny: DefaultDenyColumns},
+			"SELECT * FROM users WHERE name = '<redacted>' AND password = '<redacted>' AND age = 30"},
+		{valuePolicy{mode: LogValuesNone, deny: DefaultDenyColumns}, statement},
+		{valuePolicy{mode: LogValuesFull, maxLength: 3},
+			"SELECT * FROM users WHERE name = 'ali...(7 bytes)' AND password = 'hun...(9 bytes)' AND age = 30"},
+	}
+	for _, tt := range tests {
+		if got := tt.policy.formatSQL(statement, values); got != tt.want {
+			t.Errorf("%+v: formatSQL = %q, want %q", tt.policy, got, tt.want)
+		}
+	}
+}
+
+func TestValuePolicyDenied(t *testing.T) {
+	p := valuePolicy{deny: []string{"pass", "*token*"}}
+	tests := []struct {
+		column string
+		want   bool
+	}{
+		{"pass", true},
+		{"`PASS`", true},
+		{`"users"."pass"`, true},
+		{"passenger_count", false},
+		{"access_token", true},
+		{"name", false},
+	}
+	for _, tt := range tests {
+		if got := p.denied(tt.column); got != tt.want {
+			t.Errorf("denied(%q) = %v, want %v", tt.column, got, tt.want)
+		}
+	}
+}
+
+func TestNewValuePolicyUnknownMode(t *testing.T) {
+	key := config.Section("gorm").Key("log.values")
+	defer key.SetValue(key.String())
+
+	key.SetValue("redact")
+	if _, err := newValuePolicy(); err == nil {
+		t.Fatal("want error for log.values = redact")
+	}
+	key.SetValue("Redacted")
+	if p, err := newValuePolicy(); err != nil || p.mode != LogValuesRedacted {
+		t.Fatalf("newValuePolicy = %+v, %v", p, err)
+	}
+}
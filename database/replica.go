@@ -0,0 +1,243 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	PolicyRoundRobin = "round_robin"
+	PolicyLeastConn  = "least_conn"
+
+	DefaultCheckInterval = 5 * time.Second
+	DefaultCheckTimeout  = time.Second
+)
+
+var clusterMap sync.Map
+
+type primaryKey struct{}
+
+// ForcePrimary marks ctx so that Cluster.ReadContext uses the primary, e.g. to read your own writes
+func ForcePrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
+
+type replica struct {
+	addr    string
+	db      *gorm.DB
+	healthy int32
+}
+
+// Cluster 主从读写分离，写操作及事务使用主库，读操作在健康的从库间分配，从库全部不可用时回退至主库
+type Cluster struct {
+	name     string
+	primary  *gorm.DB
+	replicas []*replica
+	policy   string
+	next     uint32
+
+	mu   sync.Mutex
+	done chan struct{}
+}
+
+// NewCluster 按 [database] name.replicas = host1:port,host2:port 创建读写分离句柄，主库与 NewDB(name) 共用；
+// 与 NewDB 一致，配置错误时 panic *ConfigError
+func NewCluster(databaseName string) *Cluster {
+	if c, ok := clusterMap.Load(databaseName); ok {
+		return c.(*Cluster)
+	}
+
+	primary := NewDB(databaseName)
+
+	l := openLock(databaseName + ".replicas")
+	l.Lock()
+	defer l.Unlock()
+	if c, ok := clusterMap.Load(databaseName); ok {
+		return c.(*Cluster)
+	}
+
+	confMu.Lock()
+	policy := dbConf.Key(databaseName + ".replica_policy").MustString(PolicyRoundRobin)
+	addrs := dbConf.Key(databaseName + ".replicas").Strings(",")
+	interval := dbConf.Key(databaseName + ".replica_check_interval").MustDuration(DefaultCheckInterval)
+	timeout := dbConf.Key(databaseName + ".replica_check_timeout").MustDuration(DefaultCheckTimeout)
+	confMu.Unlock()
+	if policy != PolicyRoundRobin && policy != PolicyLeastConn {
+		panic(&ConfigError{databaseName, fmt.Errorf("unknown replica_policy: %s", policy)})
+	}
+
+	c := &Cluster{
+		name:    databaseName,
+		primary: primary,
+		policy:  policy,
+		done:    make(chan struct{}),
+	}
+	for _, addr := range addrs {
+		r := &replica{addr: addr}
+		// 启动时不可用的从库先剔除，由健康检查恢复
+		c.connect(r)
+		c.replicas = append(c.replicas, r)
+	}
+
+	if len(c.replicas) > 0 {
+		go c.check(interval, timeout)
+	}
+
+	mu.Lock()
+	clusterMap.Store(databaseName, c)
+	mu.Unlock()
+	return c
+}
+
+// Write returns the primary, used for writes and transactions
+func (c *Cluster) Write() *gorm.DB {
+	return c.primary
+}
+
+// Begin starts a transaction on the primary
+func (c *Cluster) Begin() *gorm.DB {
+	return c.primary.Begin()
+}
+
+// Read returns a healthy replica chosen by the configured policy, or the primary if none is available
+func (c *Cluster) Read() *gorm.DB {
+	var healthy []*replica
+	for _, r := range c.replicas {
+		if atomic.LoadInt32(&r.healthy) == 1 {
+			healthy = append(healthy, r)
+		}
+	}
+	if len(healthy) == 0 {
+		return c.primary
+	}
+
+	switch c.policy {
+	case PolicyLeastConn:
+		best := healthy[0]
+		bestInUse := best.db.DB().Stats().InUse
+		for _, r := range healthy[1:] {
+			if inUse := r.db.DB().Stats().InUse; inUse < bestInUse {
+				best, bestInUse = r, inUse
+			}
+		}
+		return best.db
+	default:
+		n := atomic.AddUint32(&c.next, 1)
+		return healthy[int(n-1)%len(healthy)].db
+	}
+}
+
+// ReadContext is like Read, but returns the primary if ctx is marked by ForcePrimary
+func (c *Cluster) ReadContext(ctx context.Context) *gorm.DB {
+	if force, _ := ctx.Value(primaryKey{}).(bool); force {
+		return c.primary
+	}
+	return c.Read()
+}
+
+// Close stops the health check and closes the replica connections, the primary is left to NewDB
+func (c *Cluster) Close() error {
+	return c.closeContext(context.Background())
+}
+
+func (c *Cluster) closeContext(ctx context.Context) error {
+	c.mu.Lock()
+	select {
+	case <-c.done:
+		c.mu.Unlock()
+		return nil
+	default:
+		close(c.done)
+	}
+	var dbs []*gorm.DB
+	for _, r := range c.replicas {
+		atomic.StoreInt32(&r.healthy, 0)
+		if r.db != nil {
+			dbs = append(dbs, r.db)
+		}
+	}
+	c.mu.Unlock()
+
+	// 等待进行中的查询时不持有 c.mu
+	var err error
+	for _, db := range dbs {
+		if e := closeDB(ctx, db); e != nil && err == nil {
+			err = e
+		}
+	}
+	clusterMap.Delete(c.name)
+	return err
+}
+
+// connect 连接 r，不持有 c.mu，连接成功后在 c.mu 下替换 r.db；Cluster 已关闭时关闭新连接
+func (c *Cluster) connect(r *replica) {
+	host, port, err := net.SplitHostPort(strings.TrimSpace(r.addr))
+	var db *gorm.DB
+	if err == nil {
+		db, err = openDB(context.Background(), c.name, host, port)
+	}
+	if err != nil {
+		log.Println("[database] " + c.name + " replica " + r.addr + ": " + err.Error())
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	select {
+	case <-c.done:
+		db.Close()
+		return
+	default:
+	}
+	r.db = db
+	atomic.StoreInt32(&r.healthy, 1)
+}
+
+// replicaDB 返回 r 当前的连接，未连接时为 nil
+func (c *Cluster) replicaDB(r *replica) *gorm.DB {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return r.db
+}
+
+func (c *Cluster) check(interval, timeout time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.done:
+			return
+		case <-ticker.C:
+		}
+
+		// 连接、ping 期间不持有 c.mu，PoolStats、Close 不被慢速的重连阻塞
+		for _, r := range c.replicas {
+			db := c.replicaDB(r)
+			if db == nil {
+				c.connect(r)
+				continue
+			}
+
+			ctx, cancel := context.WithTimeout(context.Background(), timeout)
+			err := db.DB().PingContext(ctx)
+			cancel()
+
+			if err != nil {
+				if atomic.SwapInt32(&r.healthy, 0) == 1 {
+					log.Println("[database] " + c.name + " replica " + r.addr + " ejected: " + err.Error())
+				}
+			} else if atomic.SwapInt32(&r.healthy, 1) == 0 {
+				log.Println("[database] " + c.name + " replica " + r.addr + " recovered")
+			}
+		}
+	}
+}
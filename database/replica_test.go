@@ -0,0 +1,21 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+func TestNewClusterUnknownPolicy(t *testing.T) {
+	key := config.Section("database").Key("test.replica_policy")
+	key.SetValue("least_conns")
+	defer key.SetValue(PolicyRoundRobin)
+
+	defer func() {
+		err, ok := recover().(*ConfigError)
+		if !ok || err.Name != "test" {
+			t.Errorf("recover() = %v, want *ConfigError", err)
+		}
+	}()
+	NewCluster("test")
+}
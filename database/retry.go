@@ -0,0 +1,74 @@
+package database
+
+import (
+	"context"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/jinzhu/gorm"
+)
+
+const (
+	DefaultRetryAttempts   = 1
+	DefaultRetryBackoff    = 500 * time.Millisecond
+	DefaultRetryMaxBackoff = 10 * time.Second
+)
+
+type retryPolicy struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+	deadline   time.Duration // 0 means no overall deadline
+}
+
+func newRetryPolicy(databaseName string) retryPolicy {
+	p := retryPolicy{
+		attempts:   dbConf.Key(databaseName + ".retry_attempts").MustInt(DefaultRetryAttempts),
+		backoff:    dbConf.Key(databaseName + ".retry_backoff").MustDuration(DefaultRetryBackoff),
+		maxBackoff: dbConf.Key(databaseName + ".retry_max_backoff").MustDuration(DefaultRetryMaxBackoff),
+		deadline:   dbConf.Key(databaseName + ".retry_deadline").MustDuration(0),
+	}
+	if p.attempts < 1 {
+		p.attempts = 1
+	}
+	return p
+}
+
+// openRetry 连接失败时以指数退避重试，配置错误立即返回；deadline 同时限制每次连接的 ping
+func openRetry(databaseName, host, port string, p retryPolicy) (*gorm.DB, error) {
+	ctx := context.Background()
+	var deadline time.Time
+	if p.deadline > 0 {
+		deadline = time.Now().Add(p.deadline)
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, deadline)
+		defer cancel()
+	}
+
+	backoff := p.backoff
+	for attempt := 1; ; attempt++ {
+		db, err := openDB(ctx, databaseName, host, port)
+		if err == nil {
+			return db, nil
+		}
+
+		connErr, ok := err.(*ConnectError)
+		if !ok {
+			return nil, err
+		}
+		connErr.Attempts = attempt
+
+		if attempt >= p.attempts || (!deadline.IsZero() && time.Now().Add(backoff).After(deadline)) {
+			return nil, connErr
+		}
+
+		log.Println("[database] " + databaseName + " attempt " + strconv.Itoa(attempt) + ": " + connErr.Err.Error() +
+			", retry in " + backoff.String())
+		time.Sleep(backoff)
+
+		if backoff *= 2; backoff > p.maxBackoff {
+			backoff = p.maxBackoff
+		}
+	}
+}
@@ -0,0 +1,337 @@
+package database
+
+import (
+	"context"
+	"crypto/md5"
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/config"
+)
+
+const (
+	StrategyModulo     = "modulo"
+	StrategyConsistent = "consistent"
+	StrategyRange      = "range"
+
+	DefaultVirtualNodes = 160
+)
+
+// Strategy picks the shard of key, names are the [database] names of the shards
+type Strategy interface {
+	Pick(key interface{}, names []string) (int, error)
+}
+
+// preparer 由需要按分片名预先计算的 Strategy 实现，Sharded 调用一次，路由使用返回的 Strategy
+type preparer interface {
+	prepare(names []string) (Strategy, error)
+}
+
+// keyInt 整数分片键原样使用，字符串分片键取 crc32
+func keyInt(key interface{}) (int64, error) {
+	v := reflect.ValueOf(key)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int(), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()), nil
+	case reflect.String:
+		return int64(crc32.ChecksumIEEE([]byte(v.String()))), nil
+	default:
+		return 0, fmt.Errorf("database: unsupported shard key type %T", key)
+	}
+}
+
+// Modulo picks key % len(names)
+type Modulo struct{}
+
+func (Modulo) Pick(key interface{}, names []string) (int, error) {
+	k, err := keyInt(key)
+	if err != nil {
+		return 0, err
+	}
+	idx := int(k % int64(len(names)))
+	if idx < 0 {
+		idx += len(names)
+	}
+	return idx, nil
+}
+
+// ConsistentHash places VirtualNodes points per shard on a hash ring, adding a shard only moves the keys
+// of its neighbours. Sharded builds the ring once per router, calling Pick directly builds it on every call
+type ConsistentHash struct {
+	VirtualNodes int
+}
+
+func (c ConsistentHash) prepare(names []string) (Strategy, error) {
+	vnodes := c.VirtualNodes
+	if vnodes <= 0 {
+		vnodes = DefaultVirtualNodes
+	}
+
+	ring := &hashRing{owner: map[uint32]int{}}
+	for i, name := range names {
+		for v := 0; v < vnodes; v++ {
+			sum := md5.Sum([]byte(name + "#" + strconv.Itoa(v)))
+			point := binary.BigEndian.Uint32(sum[:4])
+			if _, ok := ring.owner[point]; ok {
+				continue
+			}
+			ring.owner[point] = i
+			ring.points = append(ring.points, point)
+		}
+	}
+	sort.Slice(ring.points, func(i, j int) bool { return ring.points[i] < ring.points[j] })
+	return ring, nil
+}
+
+func (c ConsistentHash) Pick(key interface{}, names []string) (int, error) {
+	ring, _ := c.prepare(names)
+	return ring.Pick(key, names)
+}
+
+// hashRing 为 ConsistentHash 按一组分片名构建的哈希环
+type hashRing struct {
+	points []uint32
+	owner  map[uint32]int
+}
+
+func (r *hashRing) Pick(key interface{}, names []string) (int, error) {
+	var h uint32
+	if s, ok := key.(string); ok {
+		h = crc32.ChecksumIEEE([]byte(s))
+	} else {
+		k, err := keyInt(key)
+		if err != nil {
+			return 0, err
+		}
+		h = crc32.ChecksumIEEE([]byte(strconv.FormatInt(k, 10)))
+	}
+
+	i := sort.Search(len(r.points), func(i int) bool { return r.points[i] >= h })
+	if i == len(r.points) {
+		i = 0
+	}
+	return r.owner[r.points[i]], nil
+}
+
+// RangeBound maps keys >= Min (up to the next bound) to the shard Name
+type RangeBound struct {
+	Min  int64
+	Name string
+}
+
+// Range picks the shard by the bound containing key, keys below the first bound are rejected.
+// Sharded sorts the bounds and checks their names once, calling Pick directly does it on every call
+type Range []RangeBound
+
+func (r Range) prepare(names []string) (Strategy, error) {
+	bounds := make(Range, len(r))
+	copy(bounds, r)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i].Min < bounds[j].Min })
+
+	sorted := &sortedRange{mins: make([]int64, len(bounds)), shards: make([]int, len(bounds))}
+	for i, b := range bounds {
+		if i > 0 && b.Min == bounds[i-1].Min {
+			return nil, fmt.Errorf("database: duplicate range bound %d", b.Min)
+		}
+		sorted.mins[i], sorted.shards[i] = b.Min, -1
+		for idx, name := range names {
+			if name == b.Name {
+				sorted.shards[i] = idx
+				break
+			}
+		}
+		if sorted.shards[i] < 0 {
+			return nil, fmt.Errorf("database: range shard %s is not in %v", b.Name, names)
+		}
+	}
+	return sorted, nil
+}
+
+func (r Range) Pick(key interface{}, names []string) (int, error) {
+	sorted, err := r.prepare(names)
+	if err != nil {
+		return 0, err
+	}
+	return sorted.Pick(key, names)
+}
+
+// sortedRange 为 Range 按下限排序并解析出分片下标的结果
+type sortedRange struct {
+	mins   []int64
+	shards []int
+}
+
+func (r *sortedRange) Pick(key interface{}, names []string) (int, error) {
+	k, err := keyInt(key)
+	if err != nil {
+		return 0, err
+	}
+	i := sort.Search(len(r.mins), func(i int) bool { return r.mins[i] > k }) - 1
+	if i < 0 {
+		return 0, fmt.Errorf("database: shard key %d out of range", k)
+	}
+	return r.shards[i], nil
+}
+
+// ShardRouter 按分片键选择 [database] 中配置的分片
+type ShardRouter struct {
+	names    []string
+	strategy Strategy
+}
+
+// Sharded returns a router over the databases configured as names. ConsistentHash and Range are prepared
+// for names here, an error is returned if a range names a database that is not in names
+func Sharded(names []string, strategy Strategy) (*ShardRouter, error) {
+	if len(names) == 0 {
+		return nil, fmt.Errorf("database: no shards")
+	}
+	if p, ok := strategy.(preparer); ok {
+		var err error
+		if strategy, err = p.prepare(names); err != nil {
+			return nil, err
+		}
+	}
+	return &ShardRouter{names: names, strategy: strategy}, nil
+}
+
+// ShardedFromConfig 按 [sharding] 配置创建路由：
+//
+//	orders.shards = order0,order1
+//	; modulo、consistent、range
+//	orders.strategy = range
+//	orders.ranges = 0:order0,1000000:order1
+//	orders.virtual_nodes = 160
+func ShardedFromConfig(routerName string) (*ShardRouter, error) {
+	conf := config.Section("sharding")
+	names := conf.Key(routerName + ".shards").Strings(",")
+	if len(names) == 0 {
+		return nil, &ConfigError{routerName, fmt.Errorf("sharding shards is empty")}
+	}
+
+	var strategy Strategy
+	switch s := conf.Key(routerName + ".strategy").MustString(StrategyModulo); s {
+	case StrategyModulo:
+		strategy = Modulo{}
+	case StrategyConsistent:
+		strategy = ConsistentHash{VirtualNodes: conf.Key(routerName + ".virtual_nodes").MustInt(DefaultVirtualNodes)}
+	case StrategyRange:
+		var bounds Range
+		for _, item := range conf.Key(routerName + ".ranges").Strings(",") {
+			parts := strings.SplitN(item, ":", 2)
+			if len(parts) != 2 {
+				return nil, &ConfigError{routerName, fmt.Errorf("invalid range %q", item)}
+			}
+			min, err := strconv.ParseInt(strings.TrimSpace(parts[0]), 10, 64)
+			if err != nil {
+				return nil, &ConfigError{routerName, fmt.Errorf("invalid range %q: %v", item, err)}
+			}
+			bounds = append(bounds, RangeBound{Min: min, Name: strings.TrimSpace(parts[1])})
+		}
+		if len(bounds) == 0 {
+			return nil, &ConfigError{routerName, fmt.Errorf("sharding ranges is empty")}
+		}
+		strategy = bounds
+	default:
+		return nil, &ConfigError{routerName, fmt.Errorf("unknown sharding strategy: %s", s)}
+	}
+
+	r, err := Sharded(names, strategy)
+	if err != nil {
+		return nil, &ConfigError{routerName, err}
+	}
+	return r, nil
+}
+
+// Names returns the shard names
+func (r *ShardRouter) Names() []string {
+	return r.names
+}
+
+// Name returns the shard name of key
+func (r *ShardRouter) Name(key interface{}) (string, error) {
+	if len(r.names) == 0 {
+		return "", fmt.Errorf("database: no shards")
+	}
+	idx, err := r.strategy.Pick(key, r.names)
+	if err != nil {
+		return "", err
+	}
+	return r.names[idx], nil
+}
+
+// DB returns the handle of the shard of key
+func (r *ShardRouter) DB(key interface{}) (*gorm.DB, error) {
+	name, err := r.Name(key)
+	if err != nil {
+		return nil, err
+	}
+	return Open(name)
+}
+
+// FanOut runs fn on every shard concurrently and appends the rows each call stores into its out
+// (a pointer to a new slice of dest's type) to dest, in shard order. The first error cancels ctx of the others.
+//
+//	var orders []Order
+//	err := router.FanOut(ctx, &orders, func(db *gorm.DB, out interface{}) error {
+//		return db.Where("user_id = ?", uid).Find(out).Error
+//	})
+func (r *ShardRouter) FanOut(ctx context.Context, dest interface{}, fn func(db *gorm.DB, out interface{}) error) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("database: FanOut dest must be a pointer to slice, got %T", dest)
+	}
+	sliceType := destValue.Elem().Type()
+
+	// 全部分片打开后再执行，避免部分分片已开始执行时返回
+	dbs := make([]*gorm.DB, len(r.names))
+	for i, name := range r.names {
+		db, err := Open(name)
+		if err != nil {
+			return err
+		}
+		dbs[i] = db
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg   sync.WaitGroup
+		once sync.Once
+		err  error
+		outs = make([]reflect.Value, len(r.names))
+	)
+	for i, name := range r.names {
+		outs[i] = reflect.New(sliceType)
+		wg.Add(1)
+		go func(name string, db *gorm.DB, out reflect.Value) {
+			defer wg.Done()
+			if e := fn(WithContext(ctx, db), out.Interface()); e != nil {
+				once.Do(func() {
+					err = fmt.Errorf("database: shard %s: %v", name, e)
+					cancel()
+				})
+			}
+		}(name, dbs[i], outs[i])
+	}
+	wg.Wait()
+
+	if err != nil {
+		return err
+	}
+	merged := destValue.Elem()
+	for _, out := range outs {
+		merged = reflect.AppendSlice(merged, out.Elem())
+	}
+	destValue.Elem().Set(merged)
+	return nil
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"testing"
+
+	"github.com/qkzsky/go-utils/config"
+)
+
+func TestShardedRange(t *testing.T) {
+	r, err := Sharded([]string{"s0", "s1"}, Range{{Min: 1000, Name: "s1"}, {Min: 0, Name: "s0"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[int64]string{0: "s0", 999: "s0", 1000: "s1", 1 << 40: "s1"} {
+		if got, err := r.Name(key); err != nil || got != want {
+			t.Errorf("Name(%d) = %q, %v, want %q", key, got, err, want)
+		}
+	}
+	if _, err := r.Name(-1); err == nil {
+		t.Error("key below the first bound accepted")
+	}
+
+	if _, err := Sharded([]string{"s0", "s1"}, Range{{Min: 0, Name: "s0"}, {Min: 1000, Name: "s2"}}); err == nil {
+		t.Error("range naming an unknown shard accepted")
+	}
+	if _, err := Sharded([]string{"s0", "s1"}, Range{{Min: 0, Name: "s0"}, {Min: 0, Name: "s1"}}); err == nil {
+		t.Error("duplicate range bound accepted")
+	}
+}
+
+func TestShardedFromConfigUnknownRangeShard(t *testing.T) {
+	section := config.Section("sharding")
+	for key, value := range map[string]string{
+		"typo.shards": "s0,s1", "typo.strategy": "range", "typo.ranges": "0:s0,1000:s01",
+	} {
+		section.Key(key).SetValue(value)
+	}
+	if _, err := ShardedFromConfig("typo"); err == nil {
+		t.Fatal("range naming an unknown shard accepted")
+	} else if e, ok := err.(*ConfigError); !ok || e.Name != "typo" {
+		t.Errorf("err = %v, want *ConfigError", err)
+	}
+}
+
+// TestShardedConsistentHashShared 同一 ConsistentHash 值用于分片不同的路由时，各自按自身分片构建哈希环
+func TestShardedConsistentHashShared(t *testing.T) {
+	strategy := &ConsistentHash{VirtualNodes: 16}
+	small, err := Sharded([]string{"a0", "a1"}, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, err := Sharded([]string{"b0", "b1", "b2", "b3"}, strategy)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fresh, _ := Sharded([]string{"b0", "b1", "b2", "b3"}, ConsistentHash{VirtualNodes: 16})
+
+	seen := map[string]bool{}
+	for key := 0; key < 200; key++ {
+		if _, err := small.Name(key); err != nil {
+			t.Fatal(err)
+		}
+		got, _ := large.Name(key)
+		want, _ := fresh.Name(key)
+		if got != want {
+			t.Fatalf("Name(%d) = %q, want %q", key, got, want)
+		}
+		seen[got] = true
+	}
+	if len(seen) != 4 {
+		t.Errorf("keys routed to %d of 4 shards", len(seen))
+	}
+}
@@ -0,0 +1,163 @@
+package database
+
+import (
+	"encoding/json"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	DefaultMaxFingerprints = 1000
+	otherFingerprint       = "<other>"
+	latencySamples         = 512
+)
+
+var (
+	stringLiteralRegexp  = regexp.MustCompile(`'(?:[^'\\]|\\.|'')*'`)
+	numberLiteralRegexp  = regexp.MustCompile(`(?:\B-)?\b\d+(?:\.\d+)?\b`)
+	placeholderRegexp    = regexp.MustCompile(`\$\d+`)
+	inListRegexp         = regexp.MustCompile(`(?i)\bin\s*\(\s*\?(?:\s*,\s*\?)*\s*\)`)
+	valuesListRegexp     = regexp.MustCompile(`(\(\s*\?(?:\s*,\s*\?)*\s*\))(?:\s*,\s*\(\s*\?(?:\s*,\s*\?)*\s*\))+`)
+	queryStats           = map[string]*queryStat{}
+	queryStatsMu         sync.Mutex
+	queryStatsMaxEntries = DefaultMaxFingerprints
+)
+
+// QueryStat 同一 fingerprint 语句的聚合统计，耗时单位为毫秒
+type QueryStat struct {
+	Fingerprint string  `json:"fingerprint"`
+	Sample      string  `json:"sample"`
+	Count       int64   `json:"count"`
+	Rows        int64   `json:"rows"`
+	TotalMs     float64 `json:"total_ms"`
+	AvgMs       float64 `json:"avg_ms"`
+	MaxMs       float64 `json:"max_ms"`
+	P99Ms       float64 `json:"p99_ms"`
+}
+
+type queryStat struct {
+	sample  string
+	count   int64
+	rows    int64
+	total   time.Duration
+	max     time.Duration
+	samples []time.Duration
+}
+
+// Fingerprint 将字面量、占位符替换为 ?，IN 列表及多行 VALUES 折叠，用于聚合相同结构的语句
+func Fingerprint(statement string) string {
+	s := stringLiteralRegexp.ReplaceAllString(statement, "?")
+	s = placeholderRegexp.ReplaceAllString(s, "?")
+	s = numberLiteralRegexp.ReplaceAllString(s, "?")
+	s = inListRegexp.ReplaceAllString(s, "in (?+)")
+	s = valuesListRegexp.ReplaceAllString(s, "$1")
+	return strings.ToLower(normalizeSQL(s))
+}
+
+func recordQuery(statement string, elapsed time.Duration, rows int64) {
+	fp := Fingerprint(statement)
+
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+
+	st, ok := queryStats[fp]
+	if !ok {
+		if len(queryStats) >= queryStatsMaxEntries {
+			fp = otherFingerprint
+			st = queryStats[fp]
+		}
+		if st == nil {
+			st = &queryStat{sample: normalizeSQL(statement)}
+			queryStats[fp] = st
+		}
+	}
+
+	st.count++
+	st.rows += rows
+	st.total += elapsed
+	if elapsed > st.max {
+		st.max = elapsed
+	}
+	// 环形保留最近 latencySamples 次耗时用于计算 p99
+	if len(st.samples) < latencySamples {
+		st.samples = append(st.samples, elapsed)
+	} else {
+		st.samples[st.count%latencySamples] = elapsed
+	}
+}
+
+func ms(d time.Duration) float64 {
+	return float64(d) / float64(time.Millisecond)
+}
+
+// QueryStats returns the statistics of every fingerprint ordered by total time, most expensive first
+func QueryStats() []QueryStat {
+	queryStatsMu.Lock()
+	list := make([]QueryStat, 0, len(queryStats))
+	for fp, st := range queryStats {
+		samples := make([]time.Duration, len(st.samples))
+		copy(samples, st.samples)
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+
+		list = append(list, QueryStat{
+			Fingerprint: fp,
+			Sample:      st.sample,
+			Count:       st.count,
+			Rows:        st.rows,
+			TotalMs:     ms(st.total),
+			AvgMs:       ms(st.total) / float64(st.count),
+			MaxMs:       ms(st.max),
+			P99Ms:       ms(samples[(len(samples)*99-1)/100]),
+		})
+	}
+	queryStatsMu.Unlock()
+
+	sort.Slice(list, func(i, j int) bool { return list[i].TotalMs > list[j].TotalMs })
+	return list
+}
+
+// ResetQueryStats clears the collected statistics
+func ResetQueryStats() {
+	queryStatsMu.Lock()
+	defer queryStatsMu.Unlock()
+	queryStats = map[string]*queryStat{}
+}
+
+// QueryStatsHandler serves QueryStats as JSON, ?sort=total|count|avg|max|p99 and ?limit=n are supported,
+// DELETE resets the statistics
+func QueryStatsHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodDelete {
+			ResetQueryStats()
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+
+		list := QueryStats()
+		var key func(s QueryStat) float64
+		switch r.URL.Query().Get("sort") {
+		case "count":
+			key = func(s QueryStat) float64 { return float64(s.Count) }
+		case "avg":
+			key = func(s QueryStat) float64 { return s.AvgMs }
+		case "max":
+			key = func(s QueryStat) float64 { return s.MaxMs }
+		case "p99":
+			key = func(s QueryStat) float64 { return s.P99Ms }
+		}
+		if key != nil {
+			sort.SliceStable(list, func(i, j int) bool { return key(list[i]) > key(list[j]) })
+		}
+		if limit, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && limit >= 0 && limit < len(list) {
+			list = list[:limit]
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(list)
+	})
+}
@@ -0,0 +1,24 @@
+package database
+
+import "testing"
+
+func TestFingerprint(t *testing.T) {
+	tests := []struct {
+		statement string
+		want      string
+	}{
+		{"SELECT * FROM users WHERE id = 42", "select * from users where id = ?"},
+		{"SELECT * FROM users WHERE name = 'it''s' AND note = 'a\\'b'", "select * from users where name = ? and note = ?"},
+		{"SELECT * FROM users WHERE id = $1 AND age > $2", "select * from users where id = ? and age > ?"},
+		{"SELECT * FROM users WHERE id IN (?, ?, ?)", "select * from users where id in (?+)"},
+		{"SELECT * FROM users WHERE id in (1,2)", "select * from users where id in (?+)"},
+		{"INSERT INTO t (a, b) VALUES (?, ?), (?, ?), (?, ?)", "insert into t (a, b) values (?, ?)"},
+		{"SELECT  *\n\tFROM t1  WHERE price = -1.5", "select * from t1 where price = ?"},
+		{"UPDATE t SET n = n-1 WHERE id = 7", "update t set n = n-? where id = ?"},
+	}
+	for _, tt := range tests {
+		if got := Fingerprint(tt.statement); got != tt.want {
+			t.Errorf("Fingerprint(%q) = %q, want %q", tt.statement, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,81 @@
+package database
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/trace"
+)
+
+var tableRegexp = regexp.MustCompile("(?i)\\b(?:from|into|update)\\s+([\\w`\".]+)")
+
+const (
+	contextKey = "go-utils:context"
+	spanKey    = "go-utils:span"
+)
+
+// init 在 gorm 的全局回调上注册 span，对 Create、Find、Update、Delete 及 Row、Rows、Scan 生效；
+// db.Exec 不经过回调，由 WithContext 绑定的连接记录，见 ctxDB
+func init() {
+	callback := gorm.DefaultCallback
+	callback.Create().Before("gorm:create").Register("go-utils:trace_before_create", startSpan)
+	callback.Create().After("gorm:create").Register("go-utils:trace_after_create", finishSpan)
+	callback.Query().Before("gorm:query").Register("go-utils:trace_before_query", startSpan)
+	callback.Query().After("gorm:query").Register("go-utils:trace_after_query", finishSpan)
+	callback.Update().Before("gorm:update").Register("go-utils:trace_before_update", startSpan)
+	callback.Update().After("gorm:update").Register("go-utils:trace_after_update", finishSpan)
+	callback.Delete().Before("gorm:delete").Register("go-utils:trace_before_delete", startSpan)
+	callback.Delete().After("gorm:delete").Register("go-utils:trace_after_delete", finishSpan)
+	callback.RowQuery().Before("gorm:row_query").Register("go-utils:trace_before_row_query", startSpan)
+	callback.RowQuery().After("gorm:row_query").Register("go-utils:trace_after_row_query", finishSpan)
+}
+
+// startSpan 仅在 WithContext 绑定的 ctx 中已有 span 时记录子 span
+func startSpan(scope *gorm.Scope) {
+	if !trace.Enabled() {
+		return
+	}
+	v, ok := scope.Get(contextKey)
+	if !ok {
+		return
+	}
+	ctx, _ := v.(context.Context)
+	if trace.FromContext(ctx) == nil {
+		return
+	}
+
+	_, span := trace.Start(ctx, "db", trace.KindClient)
+	scope.InstanceSet(spanKey, span)
+}
+
+func finishSpan(scope *gorm.Scope) {
+	v, ok := scope.InstanceGet(spanKey)
+	if !ok {
+		return
+	}
+	finishStatementSpan(v.(*trace.Span), scope.Dialect().GetName(), scope.SQL, scope.DB().RowsAffected, scope.DB().Error)
+}
+
+func finishStatementSpan(span *trace.Span, system, statement string, rows int64, err error) {
+	operation := ""
+	if fields := strings.Fields(statement); len(fields) > 0 {
+		operation = strings.ToUpper(fields[0])
+	}
+	table := ""
+	if m := tableRegexp.FindStringSubmatch(statement); m != nil {
+		table = strings.Trim(m[1], "`\"")
+	}
+
+	span.Name = strings.TrimSpace(operation + " " + table)
+	span.SetAttribute("db.system", system)
+	span.SetAttribute("db.operation", operation)
+	span.SetAttribute("db.sql.table", table)
+	span.SetAttribute("db.statement", Fingerprint(statement))
+	span.SetAttribute("db.rows_affected", rows)
+	if err != nil && !gorm.IsRecordNotFoundError(err) {
+		span.SetError(err)
+	}
+	span.Finish()
+}
@@ -0,0 +1,56 @@
+package database
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"github.com/qkzsky/go-utils/trace"
+)
+
+func TestStatementSpans(t *testing.T) {
+	var (
+		mu    sync.Mutex
+		names []string
+	)
+	trace.SetExporter(trace.ExporterFunc(func(spans []*trace.Span) error {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, s := range spans {
+			if s.Kind == trace.KindClient {
+				names = append(names, s.Name)
+			}
+		}
+		return nil
+	}))
+	defer trace.SetExporter(nil)
+
+	db, err := Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := db.AutoMigrate(&contextUser{}).Error; err != nil {
+		t.Fatal(err)
+	}
+	defer db.DropTable(&contextUser{})
+
+	ctx, root := trace.Start(context.Background(), "request", trace.KindServer)
+	bound := WithContext(ctx, db)
+	// db.Exec 不经过回调，由 ctxDB 记录；Find 由回调记录，ctxDB 不重复记录
+	if err := bound.Exec("INSERT INTO context_users (name) VALUES (?)", "a").Error; err != nil {
+		t.Fatal(err)
+	}
+	var users []contextUser
+	if err := bound.Find(&users).Error; err != nil {
+		t.Fatal(err)
+	}
+	root.Finish()
+	trace.Flush()
+
+	mu.Lock()
+	defer mu.Unlock()
+	want := []string{"INSERT context_users", "SELECT context_users"}
+	if len(names) != len(want) || names[0] != want[0] || names[1] != want[1] {
+		t.Errorf("spans = %q, want %q", names, want)
+	}
+}
@@ -0,0 +1,148 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strconv"
+	"sync/atomic"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+	"github.com/jinzhu/gorm"
+	"github.com/lib/pq"
+)
+
+const (
+	DefaultTxRetries    = 3
+	DefaultTxBackoff    = 50 * time.Millisecond
+	DefaultTxMaxBackoff = time.Second
+)
+
+var savepointSeq uint64
+
+// TxOptions 事务选项，nil 时使用默认重试策略
+type TxOptions struct {
+	Isolation  sql.IsolationLevel
+	ReadOnly   bool
+	Retries    int // 死锁、锁等待超时、序列化失败时重试整个函数的次数，-1 不重试
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// PanicError is returned by WithTx when fn panics, the transaction is rolled back
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("database: panic in transaction: %v", e.Value)
+}
+
+// WithTx 在事务中执行 fn，fn 返回 nil 时提交，返回错误或 panic 时回滚；
+// 遇到 MySQL 1213、1205 及 PostgreSQL 40001、40P01 时按退避重试整个 fn。
+// db 已处于事务中时使用 savepoint，错误只回滚至 savepoint，由外层事务决定重试
+func WithTx(ctx context.Context, db *gorm.DB, opts *TxOptions, fn func(tx *gorm.DB) error) error {
+	if opts == nil {
+		opts = &TxOptions{}
+	}
+	if _, ok := db.CommonDB().(*sql.Tx); ok {
+		return withSavepoint(db, fn)
+	}
+
+	retries := opts.Retries
+	if retries == 0 {
+		retries = DefaultTxRetries
+	} else if retries < 0 {
+		retries = 0
+	}
+	backoff := opts.Backoff
+	if backoff <= 0 {
+		backoff = DefaultTxBackoff
+	}
+	maxBackoff := opts.MaxBackoff
+	if maxBackoff <= 0 {
+		maxBackoff = DefaultTxMaxBackoff
+	}
+
+	for attempt := 0; ; attempt++ {
+		err := runTx(ctx, db, opts, fn)
+		if err == nil || attempt >= retries || !IsRetryable(err) {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(backoff):
+		}
+		if backoff *= 2; backoff > maxBackoff {
+			backoff = maxBackoff
+		}
+	}
+}
+
+func runTx(ctx context.Context, db *gorm.DB, opts *TxOptions, fn func(tx *gorm.DB) error) (err error) {
+	tx := db.BeginTx(ctx, &sql.TxOptions{Isolation: opts.Isolation, ReadOnly: opts.ReadOnly})
+	if tx.Error != nil {
+		return tx.Error
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Rollback()
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit().Error
+}
+
+func withSavepoint(tx *gorm.DB, fn func(tx *gorm.DB) error) (err error) {
+	name := "sp_" + strconv.FormatUint(atomic.AddUint64(&savepointSeq, 1), 10)
+	if err = tx.Exec("SAVEPOINT " + name).Error; err != nil {
+		return err
+	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+
+	if err = fn(tx); err != nil {
+		tx.Exec("ROLLBACK TO SAVEPOINT " + name)
+		return err
+	}
+	return tx.Exec("RELEASE SAVEPOINT " + name).Error
+}
+
+// IsRetryable reports whether err is a deadlock, lock wait timeout or serialization failure
+func IsRetryable(err error) bool {
+	if errs, ok := err.(gorm.Errors); ok {
+		for _, e := range errs {
+			if IsRetryable(e) {
+				return true
+			}
+		}
+		return false
+	}
+
+	var myErr *mysql.MySQLError
+	if errors.As(err, &myErr) {
+		return myErr.Number == 1213 || myErr.Number == 1205
+	}
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) {
+		return pqErr.Code == "40001" || pqErr.Code == "40P01"
+	}
+	return false
+}
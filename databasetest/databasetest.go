@@ -0,0 +1,178 @@
+// Package databasetest 数据库集成测试辅助：打开数据库、加载 YAML fixtures、每个测试在回滚的事务中执行
+//
+//	func TestUser(t *testing.T) {
+//		tx := databasetest.Begin(t, databasetest.Open(t, ""))
+//		databasetest.LoadFixtures(t, tx, "testdata/users.yml")
+//		...
+//		databasetest.AssertRow(t, tx, "users", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "a"})
+//	}
+package databasetest
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/database"
+	"gopkg.in/yaml.v2"
+)
+
+// Open returns the handle of the configured databaseName, or a new in-memory SQLite database closed
+// at the end of the test if databaseName is empty
+func Open(t testing.TB, databaseName string) *gorm.DB {
+	t.Helper()
+
+	if databaseName != "" {
+		db, err := database.Open(databaseName)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return db
+	}
+
+	db, err := gorm.Open("sqlite3", database.MemoryPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 内存数据库每个连接相互独立，限制为单个常驻连接
+	db.DB().SetMaxOpenConns(1)
+	t.Cleanup(func() {
+		db.Close()
+	})
+	return db
+}
+
+// Begin starts a transaction rolled back at the end of the test
+func Begin(t testing.TB, db *gorm.DB) *gorm.DB {
+	t.Helper()
+
+	tx := db.Begin()
+	if tx.Error != nil {
+		t.Fatal(tx.Error)
+	}
+	t.Cleanup(func() {
+		tx.Rollback()
+	})
+	return tx
+}
+
+// LoadFixtures inserts the rows of YAML files into their tables, in file order:
+//
+//	users:
+//	  - id: 1
+//	    name: a
+func LoadFixtures(t testing.TB, db *gorm.DB, files ...string) {
+	t.Helper()
+
+	for _, file := range files {
+		content, err := ioutil.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var tables yaml.MapSlice
+		if err := yaml.Unmarshal(content, &tables); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+
+		for _, item := range tables {
+			table := fmt.Sprint(item.Key)
+			var rows []map[string]interface{}
+			raw, _ := yaml.Marshal(item.Value)
+			if err := yaml.Unmarshal(raw, &rows); err != nil {
+				t.Fatalf("%s: table %s: %v", file, table, err)
+			}
+			for _, row := range rows {
+				if err := insert(db, table, row); err != nil {
+					t.Fatalf("%s: table %s: %v", file, table, err)
+				}
+			}
+		}
+	}
+}
+
+func sortedKeys(m map[string]interface{}) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func insert(db *gorm.DB, table string, row map[string]interface{}) error {
+	columns := sortedKeys(row)
+	quoted := make([]string, len(columns))
+	values := make([]interface{}, len(columns))
+	for i, column := range columns {
+		quoted[i] = db.Dialect().Quote(column)
+		values[i] = row[column]
+	}
+
+	sql := fmt.Sprintf("INSERT INTO %s (%s) VALUES (%s)", db.Dialect().Quote(table), strings.Join(quoted, ", "),
+		strings.TrimSuffix(strings.Repeat("?, ", len(columns)), ", "))
+	return db.Exec(sql, values...).Error
+}
+
+// AssertCount checks the number of rows of table matching where
+func AssertCount(t testing.TB, db *gorm.DB, table string, where map[string]interface{}, want int) {
+	t.Helper()
+
+	var n int
+	if err := db.Table(table).Where(where).Count(&n).Error; err != nil {
+		t.Fatal(err)
+	}
+	if n != want {
+		t.Errorf("%s where %v: got %d rows, want %d", table, where, n, want)
+	}
+}
+
+// AssertRow checks that exactly one row of table matches where and its columns equal want,
+// values are compared by their fmt.Sprint form so that driver types do not matter
+func AssertRow(t testing.TB, db *gorm.DB, table string, where map[string]interface{}, want map[string]interface{}) {
+	t.Helper()
+
+	columns := sortedKeys(want)
+	rows, err := db.Table(table).Where(where).Select(columns).Rows()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+
+	var got []map[string]interface{}
+	for rows.Next() {
+		values := make([]interface{}, len(columns))
+		ptrs := make([]interface{}, len(columns))
+		for i := range values {
+			ptrs[i] = &values[i]
+		}
+		if err := rows.Scan(ptrs...); err != nil {
+			t.Fatal(err)
+		}
+
+		row := map[string]interface{}{}
+		for i, column := range columns {
+			if b, ok := values[i].([]byte); ok {
+				values[i] = string(b)
+			}
+			row[column] = values[i]
+		}
+		got = append(got, row)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(got) != 1 {
+		t.Errorf("%s where %v: got %d rows, want 1", table, where, len(got))
+		return
+	}
+	for _, column := range columns {
+		if fmt.Sprint(got[0][column]) != fmt.Sprint(want[column]) {
+			t.Errorf("%s where %v: column %s = %v, want %v", table, where, column, got[0][column], want[column])
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package databasetest
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestLoadFixtures(t *testing.T) {
+	db := Open(t, "")
+	for _, stmt := range []string{
+		"CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, active BOOLEAN, note TEXT)",
+		"CREATE TABLE orders (id INTEGER PRIMARY KEY, user_id INTEGER, amount INTEGER)",
+	} {
+		if err := db.Exec(stmt).Error; err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	LoadFixtures(t, db, "testdata/users.yml", "testdata/orders.yml")
+
+	AssertCount(t, db, "users", nil, 3)
+	AssertCount(t, db, "orders", map[string]interface{}{"user_id": 1}, 1)
+	AssertRow(t, db, "users", map[string]interface{}{"id": 1},
+		map[string]interface{}{"name": "alice", "score": 9.5, "active": true, "note": nil})
+	// 带引号的数字按字符串写入
+	AssertRow(t, db, "users", map[string]interface{}{"id": 2},
+		map[string]interface{}{"name": "2", "score": 7, "active": false, "note": "it's"})
+	AssertRow(t, db, "orders", map[string]interface{}{"id": 10}, map[string]interface{}{"user_id": 1, "amount": 100})
+}
+
+func TestBeginRollback(t *testing.T) {
+	db := Open(t, "")
+	if err := db.Exec("CREATE TABLE items (id INTEGER PRIMARY KEY)").Error; err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("insert", func(t *testing.T) {
+		tx := Begin(t, db)
+		if err := tx.Exec("INSERT INTO items (id) VALUES (1)").Error; err != nil {
+			t.Fatal(err)
+		}
+		AssertCount(t, tx, "items", nil, 1)
+	})
+	// 子测试结束时 t.Cleanup 回滚事务
+	AssertCount(t, db, "items", nil, 0)
+}
+
+// recorder 记录 Errorf、Fatalf 的输出，不使外层测试失败
+type recorder struct {
+	testing.TB
+	errors []string
+}
+
+func (r *recorder) Helper() {}
+
+func (r *recorder) Errorf(format string, args ...interface{}) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+func TestAssertRowMismatch(t *testing.T) {
+	db := Open(t, "")
+	if err := db.Exec("CREATE TABLE users (id INTEGER PRIMARY KEY, name TEXT, score REAL, active BOOLEAN, note TEXT)").Error; err != nil {
+		t.Fatal(err)
+	}
+	LoadFixtures(t, db, "testdata/users.yml")
+
+	tests := []struct {
+		name  string
+		where map[string]interface{}
+		want  map[string]interface{}
+		errs  []string
+	}{
+		{"match", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "alice"}, nil},
+		{"column mismatch", map[string]interface{}{"id": 1}, map[string]interface{}{"name": "bob", "score": 9.5},
+			[]string{"column name = alice, want bob"}},
+		{"no row", map[string]interface{}{"id": 9}, map[string]interface{}{"name": "alice"},
+			[]string{"got 0 rows, want 1"}},
+		{"many rows", map[string]interface{}{}, map[string]interface{}{"name": "alice"},
+			[]string{"got 2 rows, want 1"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := &recorder{TB: t}
+			AssertRow(r, db, "users", tt.where, tt.want)
+			if len(r.errors) != len(tt.errs) {
+				t.Fatalf("errors = %q, want %q", r.errors, tt.errs)
+			}
+			for i, e := range tt.errs {
+				if !strings.Contains(r.errors[i], e) {
+					t.Errorf("error %q does not contain %q", r.errors[i], e)
+				}
+			}
+		})
+	}
+}
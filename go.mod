@@ -1,11 +1,13 @@
 module github.com/qkzsky/go-utils
 
-go 1.13
+go 1.15
 
 require (
 	github.com/gin-gonic/gin v1.5.0
 	github.com/go-redis/redis/v7 v7.0.0-beta.4
+	github.com/go-sql-driver/mysql v1.4.1
 	github.com/jinzhu/gorm v1.9.11
+	github.com/lib/pq v1.1.1
 	github.com/smartystreets/goconvey v1.6.4 // indirect
 	go.uber.org/zap v1.13.0
 	gopkg.in/ini.v1 v1.51.0
@@ -0,0 +1,212 @@
+// Package health 健康检查注册表，database.NewDB、redis.NewRedis 创建的连接自动注册，
+// 通过 pprof.Handle("/healthz", health.LiveHandler()) 与 pprof.Handle("/readyz", health.ReadyHandler()) 提供探针
+package health
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	DefaultTimeout  = time.Second
+	DefaultCacheTTL = 5 * time.Second
+
+	StatusOK       = "ok"
+	StatusDegraded = "degraded" // 非关键检查失败
+	StatusFail     = "fail"     // 关键检查失败
+)
+
+// CheckFunc returns nil if the dependency is healthy, it should respect ctx
+type CheckFunc func(ctx context.Context) error
+
+// Options of a check, zero Timeout and CacheTTL use [health] timeout and cache_ttl
+type Options struct {
+	Critical bool // 关键检查失败时 /readyz 返回 503
+	Timeout  time.Duration
+	CacheTTL time.Duration // 结果缓存时间，期间的请求不再访问后端
+}
+
+// Result of the last run of a check
+type Result struct {
+	Name        string     `json:"name"`
+	Healthy     bool       `json:"healthy"`
+	Critical    bool       `json:"critical"`
+	Latency     float64    `json:"latency_ms"`
+	Error       string     `json:"error,omitempty"`
+	LastError   string     `json:"last_error,omitempty"`
+	LastErrorAt *time.Time `json:"last_error_at,omitempty"`
+	CheckedAt   time.Time  `json:"checked_at"`
+}
+
+// Report is the body of /healthz and /readyz
+type Report struct {
+	Status string   `json:"status"`
+	App    string   `json:"app"`
+	Checks []Result `json:"checks"`
+}
+
+type check struct {
+	name string
+	fn   CheckFunc
+	opts Options
+
+	mu     sync.Mutex
+	result Result
+}
+
+var (
+	healthConf *ini.Section
+
+	mu     sync.RWMutex
+	checks = map[string]*check{}
+)
+
+func init() {
+	healthConf = config.Section("health")
+}
+
+// Register adds or replaces the check called name
+func Register(name string, fn CheckFunc, opts Options) {
+	if opts.Timeout <= 0 {
+		opts.Timeout = healthConf.Key("timeout").MustDuration(DefaultTimeout)
+	}
+	if opts.CacheTTL <= 0 {
+		opts.CacheTTL = healthConf.Key("cache_ttl").MustDuration(DefaultCacheTTL)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	checks[name] = &check{
+		name:   name,
+		fn:     fn,
+		opts:   opts,
+		result: Result{Name: name, Critical: opts.Critical},
+	}
+}
+
+// Unregister removes the check called name
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(checks, name)
+}
+
+// run 缓存未过期时直接返回，并发请求共用同一次检查；不使用请求的 ctx，避免探针超时断开后缓存失败结果
+func (c *check) run() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if !c.result.CheckedAt.IsZero() && time.Since(c.result.CheckedAt) < c.opts.CacheTTL {
+		return c.result
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), c.opts.Timeout)
+	defer cancel()
+
+	start := time.Now()
+	err := c.fn(ctx)
+	r := &c.result
+	r.Latency = float64(time.Since(start)) / float64(time.Millisecond)
+	r.CheckedAt = start
+	r.Healthy = err == nil
+	r.Error = ""
+	if err != nil {
+		r.Error = err.Error()
+		r.LastError = r.Error
+		r.LastErrorAt = &start
+	}
+	return *r
+}
+
+func (c *check) cached() Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.result
+}
+
+func list() []*check {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	l := make([]*check, 0, len(checks))
+	for _, c := range checks {
+		l = append(l, c)
+	}
+	sort.Slice(l, func(i, j int) bool { return l[i].name < l[j].name })
+	return l
+}
+
+func newReport(results []Result) Report {
+	report := Report{Status: StatusOK, App: config.AppName, Checks: results}
+	for _, r := range results {
+		if r.Healthy || r.CheckedAt.IsZero() {
+			continue
+		}
+		if r.Critical {
+			report.Status = StatusFail
+		} else if report.Status == StatusOK {
+			report.Status = StatusDegraded
+		}
+	}
+	return report
+}
+
+// Check runs every check concurrently, results younger than CacheTTL are reused
+func Check() Report {
+	l := list()
+	results := make([]Result, len(l))
+
+	var wg sync.WaitGroup
+	for i, c := range l {
+		wg.Add(1)
+		go func(i int, c *check) {
+			defer wg.Done()
+			results[i] = c.run()
+		}(i, c)
+	}
+	wg.Wait()
+	return newReport(results)
+}
+
+// Cached returns the last results without running any check
+func Cached() Report {
+	l := list()
+	results := make([]Result, len(l))
+	for i, c := range l {
+		results[i] = c.cached()
+	}
+	return newReport(results)
+}
+
+func writeReport(w http.ResponseWriter, code int, report Report) {
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.WriteHeader(code)
+	json.NewEncoder(w).Encode(report)
+}
+
+// LiveHandler serves /healthz, it reports the cached results but always answers 200 while the process is serving,
+// so that a failing backend does not restart the process
+func LiveHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeReport(w, http.StatusOK, Cached())
+	})
+}
+
+// ReadyHandler serves /readyz, it answers 503 if a critical check fails
+func ReadyHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		report := Check()
+		code := http.StatusOK
+		if report.Status == StatusFail {
+			code = http.StatusServiceUnavailable
+		}
+		writeReport(w, code, report)
+	})
+}
@@ -0,0 +1,86 @@
+package logger
+
+import (
+	"fmt"
+	"time"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/ini.v1"
+)
+
+var timeEncoderMap = map[string]zapcore.TimeEncoder{
+	"iso8601":     zapcore.ISO8601TimeEncoder,
+	"rfc3339":     LayoutTimeEncoder(time.RFC3339),
+	"rfc3339nano": LayoutTimeEncoder(time.RFC3339Nano),
+	"epoch":       zapcore.EpochTimeEncoder,
+	"millis":      zapcore.EpochMillisTimeEncoder,
+	"nanos":       zapcore.EpochNanosTimeEncoder,
+	"datetime":    TimeEncoder,
+}
+
+// logKey 优先读取 [log] {logName}.{name}，不存在时读取 [log] {name}
+func logKey(logName, name string) *ini.Key {
+	if section.HasKey(logName + "." + name) {
+		return section.Key(logName + "." + name)
+	}
+	return section.Key(name)
+}
+
+// logString is like logKey(...).MustString, but a key explicitly set to empty is kept, zap omits empty keys
+func logString(logName, name, defaultVal string) string {
+	if section.HasKey(logName+"."+name) || section.HasKey(name) {
+		return logKey(logName, name).String()
+	}
+	return defaultVal
+}
+
+// LayoutTimeEncoder serializes a time.Time with the given layout
+func LayoutTimeEncoder(layout string) zapcore.TimeEncoder {
+	return func(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
+		enc.AppendString(t.Format(layout))
+	}
+}
+
+func getTimeEncoder(format string) zapcore.TimeEncoder {
+	if format == "" {
+		return zapcore.ISO8601TimeEncoder
+	}
+	if encoder, ok := timeEncoderMap[format]; ok {
+		return encoder
+	}
+	// 其余值视为 time.Format 的 layout
+	return LayoutTimeEncoder(format)
+}
+
+func newEncoderConfig(logName string) zapcore.EncoderConfig {
+	encoder := zap.NewProductionEncoderConfig()
+	encoder.EncodeTime = getTimeEncoder(logKey(logName, "time_format").String())
+	encoder.TimeKey = logString(logName, "time_key", encoder.TimeKey)
+	encoder.MessageKey = logString(logName, "message_key", encoder.MessageKey)
+	encoder.LevelKey = logString(logName, "level_key", encoder.LevelKey)
+	return encoder
+}
+
+func newEncoder(logName string, encoder zapcore.EncoderConfig) zapcore.Encoder {
+	switch encoding := logKey(logName, "encoding").MustString("json"); encoding {
+	case "json":
+		return zapcore.NewJSONEncoder(encoder)
+	case "console":
+		return zapcore.NewConsoleEncoder(encoder)
+	default:
+		panic(fmt.Errorf("unknown log encoding: %s", encoding))
+	}
+}
+
+// loggerOptions returns caller and stacktrace options of logName
+func loggerOptions(logName string) []zap.Option {
+	var opts []zap.Option
+	if logKey(logName, "caller").MustBool(true) {
+		opts = append(opts, zap.AddCaller(), zap.AddCallerSkip(1))
+	}
+	if lvl := logKey(logName, "stacktrace_level").String(); lvl != "" {
+		opts = append(opts, zap.AddStacktrace(getLoggerLevel(lvl)))
+	}
+	return opts
+}
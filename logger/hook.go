@@ -0,0 +1,273 @@
+package logger
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/curl"
+	"go.uber.org/zap/zapcore"
+)
+
+// HookEntry is a log entry passed to hooks, Count is the number of times the same message and caller
+// occurred within the de-duplication window
+type HookEntry struct {
+	Logger  string    `json:"logger"`
+	Level   string    `json:"level"`
+	Time    time.Time `json:"time"`
+	Message string    `json:"message"`
+	Caller  string    `json:"caller,omitempty"`
+	Stack   string    `json:"stack,omitempty"`
+	Count   int       `json:"count"`
+}
+
+// HookFunc receives a batch of entries, the returned error is printed to the standard logger
+type HookFunc func(entries []HookEntry) error
+
+// HookSettings is the hook batching and de-duplication setting
+type HookSettings struct {
+	Level         zapcore.Level
+	BatchSize     int
+	FlushInterval time.Duration
+	DedupWindow   time.Duration // 0 means no de-duplication
+}
+
+// DefaultHookSettings is used when AddHook is called without settings
+var DefaultHookSettings = HookSettings{
+	Level:         zapcore.ErrorLevel,
+	BatchSize:     100,
+	FlushInterval: 5 * time.Second,
+	DedupWindow:   time.Minute,
+}
+
+var (
+	hooks   = map[string]*hook{}
+	hooksMu sync.RWMutex
+)
+
+type dedupState struct {
+	entry      HookEntry
+	first      time.Time
+	last       time.Time
+	pending    *HookEntry
+	suppressed int
+}
+
+type hook struct {
+	name     string
+	fn       HookFunc
+	settings HookSettings
+
+	mu      sync.Mutex
+	pending []*HookEntry
+	seen    map[string]*dedupState
+
+	flushCh chan struct{}
+	done    chan struct{}
+	stopped chan struct{}
+}
+
+// AddHook registers fn under name, entries at or above settings.Level of every logger created by NewLogger are
+// batched and passed to fn. A hook registered with an existing name replaces the old one.
+func AddHook(name string, fn HookFunc, settings ...HookSettings) {
+	s := DefaultHookSettings
+	if len(settings) > 0 {
+		s = settings[0]
+	}
+	if s.BatchSize <= 0 {
+		s.BatchSize = DefaultHookSettings.BatchSize
+	}
+	if s.FlushInterval <= 0 {
+		s.FlushInterval = DefaultHookSettings.FlushInterval
+	}
+
+	h := &hook{
+		name:     name,
+		fn:       fn,
+		settings: s,
+		seen:     map[string]*dedupState{},
+		flushCh:  make(chan struct{}, 1),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	go h.run()
+
+	hooksMu.Lock()
+	old := hooks[name]
+	hooks[name] = h
+	hooksMu.Unlock()
+
+	if old != nil {
+		old.stop()
+	}
+}
+
+// RemoveHook unregisters the hook and flushes its pending entries
+func RemoveHook(name string) {
+	hooksMu.Lock()
+	h := hooks[name]
+	delete(hooks, name)
+	hooksMu.Unlock()
+
+	if h != nil {
+		h.stop()
+	}
+}
+
+// FlushHooks synchronously delivers pending entries of every hook
+func FlushHooks() {
+	hooksMu.RLock()
+	list := make([]*hook, 0, len(hooks))
+	for _, h := range hooks {
+		list = append(list, h)
+	}
+	hooksMu.RUnlock()
+
+	for _, h := range list {
+		h.flush(time.Now())
+	}
+}
+
+// fireHooks returns the zap hook attached to logName
+func fireHooks(logName string) func(zapcore.Entry) error {
+	return func(ent zapcore.Entry) error {
+		hooksMu.RLock()
+		defer hooksMu.RUnlock()
+		for _, h := range hooks {
+			if ent.Level >= h.settings.Level {
+				h.add(logName, ent)
+			}
+		}
+		return nil
+	}
+}
+
+func (h *hook) add(logName string, ent zapcore.Entry) {
+	e := HookEntry{
+		Logger:  logName,
+		Level:   ent.Level.String(),
+		Time:    ent.Time,
+		Message: ent.Message,
+		Stack:   ent.Stack,
+		Count:   1,
+	}
+	if ent.Caller.Defined {
+		e.Caller = ent.Caller.TrimmedPath()
+	}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if h.settings.DedupWindow > 0 {
+		key := e.Message + "\x00" + e.Caller
+		st := h.seen[key]
+		if st != nil && e.Time.Sub(st.first) < h.settings.DedupWindow {
+			st.last = e.Time
+			if st.pending != nil {
+				st.pending.Count++
+			} else {
+				st.suppressed++
+			}
+			return
+		}
+		if st != nil {
+			e.Count += st.suppressed
+		}
+		h.seen[key] = &dedupState{entry: e, first: e.Time, last: e.Time, pending: &e}
+	}
+	h.pending = append(h.pending, &e)
+
+	if len(h.pending) >= h.settings.BatchSize {
+		select {
+		case h.flushCh <- struct{}{}:
+		default:
+		}
+	}
+}
+
+func (h *hook) flush(now time.Time) {
+	h.mu.Lock()
+	var entries []HookEntry
+	for _, e := range h.pending {
+		entries = append(entries, *e)
+	}
+	h.pending = nil
+
+	for key, st := range h.seen {
+		st.pending = nil
+		if now.Sub(st.first) < h.settings.DedupWindow {
+			continue
+		}
+		// the window expired, emit the entries suppressed since the last flush
+		if st.suppressed > 0 {
+			e := st.entry
+			e.Time = st.last
+			e.Count = st.suppressed
+			entries = append(entries, e)
+		}
+		delete(h.seen, key)
+	}
+	h.mu.Unlock()
+
+	if len(entries) == 0 {
+		return
+	}
+	if err := h.fn(entries); err != nil {
+		log.Println("[logger] hook " + h.name + ": " + err.Error())
+		for _, e := range entries {
+			atomic.AddUint64(&getMetrics(e.Logger).dropped, uint64(e.Count))
+		}
+	}
+}
+
+func (h *hook) run() {
+	defer close(h.stopped)
+
+	ticker := time.NewTicker(h.settings.FlushInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case now := <-ticker.C:
+			h.flush(now)
+		case <-h.flushCh:
+			h.flush(time.Now())
+		case <-h.done:
+			h.flush(time.Now())
+			return
+		}
+	}
+}
+
+func (h *hook) stop() {
+	close(h.done)
+	<-h.stopped
+}
+
+// NewWebhook returns a HookFunc posting entries as JSON to url
+func NewWebhook(url string, timeout time.Duration) HookFunc {
+	return func(entries []HookEntry) error {
+		req, err := curl.Post(url).
+			SetTimeout(timeout, timeout).
+			JSONBody(map[string]interface{}{
+				"app":     config.AppName,
+				"entries": entries,
+			})
+		if err != nil {
+			return err
+		}
+		if _, err = req.Bytes(); err != nil {
+			return err
+		}
+		resp, err := req.Response()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("webhook %s response %s", url, resp.Status)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,76 @@
+package logger
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+func TestNewWebhook(t *testing.T) {
+	var body struct {
+		App     string      `json:"app"`
+		Entries []HookEntry `json:"entries"`
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			t.Errorf("method = %s, want POST", r.Method)
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	entries := []HookEntry{{Logger: "app", Level: "error", Time: time.Now(), Message: "boom", Count: 2}}
+	if err := NewWebhook(srv.URL, time.Second)(entries); err != nil {
+		t.Fatal(err)
+	}
+	if body.App != "go-utils" || len(body.Entries) != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+	if e := body.Entries[0]; e.Message != "boom" || e.Count != 2 || e.Level != "error" {
+		t.Errorf("entry = %+v", e)
+	}
+}
+
+func TestNewWebhookError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer srv.Close()
+
+	if err := NewWebhook(srv.URL, time.Second)([]HookEntry{{Message: "boom"}}); err == nil {
+		t.Fatal("want error for 500 response")
+	}
+}
+
+func TestHookDedup(t *testing.T) {
+	var got []HookEntry
+	AddHook("test", func(entries []HookEntry) error {
+		got = append(got, entries...)
+		return nil
+	}, HookSettings{Level: zapcore.ErrorLevel, BatchSize: 100, FlushInterval: time.Hour, DedupWindow: time.Minute})
+	defer RemoveHook("test")
+
+	log := NewLogger("hook-test")
+	for i := 0; i < 3; i++ {
+		log.Error("same")
+	}
+	log.Warn("below level")
+	log.Error("other")
+	FlushHooks()
+
+	if len(got) != 2 {
+		t.Fatalf("got %d entries, want 2: %+v", len(got), got)
+	}
+	if got[0].Message != "same" || got[0].Count != 3 {
+		t.Errorf("entry = %+v, want same x3", got[0])
+	}
+	if got[1].Message != "other" || got[1].Count != 1 {
+		t.Errorf("entry = %+v, want other x1", got[1])
+	}
+}
@@ -52,12 +52,20 @@ func init() {
 	}
 
 	defaultLogger = NewLogger(config.AppName)
+
+	if url := section.Key("hook.webhook").String(); url != "" {
+		settings := DefaultHookSettings
+		settings.Level = getLoggerLevel(section.Key("hook.level").MustString("error"))
+		settings.DedupWindow = section.Key("hook.dedup_window").MustDuration(DefaultHookSettings.DedupWindow)
+		AddHook("webhook", NewWebhook(url, section.Key("hook.timeout").MustDuration(5*time.Second)), settings)
+	}
 }
 
 func GetPath() string {
 	return logPath
 }
 
+// TimeEncoder serializes a time.Time as 2006-01-02 15:04:05, used by [log] time_format = datetime
 func TimeEncoder(t time.Time, enc zapcore.PrimitiveArrayEncoder) {
 	enc.AppendString(t.Format("2006-01-02 15:04:05"))
 }
@@ -75,18 +83,17 @@ func NewLogger(logName string) *zap.Logger {
 
 	fileName := fmt.Sprintf("%s/%s.log", logPath, logName)
 	var logLevel zap.AtomicLevel
+	m := getMetrics(logName)
 
-	fileWriters := []zapcore.WriteSyncer{zapcore.AddSync(&lumberjack.Logger{
+	fileWriters := []zapcore.WriteSyncer{countingWriter{zapcore.AddSync(&lumberjack.Logger{
 		Filename:  fileName,
 		MaxSize:   section.Key("maxsize").MustInt(defaultMaxSize), // MB
 		LocalTime: true,
 		Compress:  section.Key("compress").MustBool(true),
-	})}
+	}), m}}
 
 	var core zapcore.Core
-	encoder := zap.NewProductionEncoderConfig()
-	//encoder.EncodeTime = TimeEncoder
-	encoder.EncodeTime = zapcore.ISO8601TimeEncoder
+	encoder := newEncoderConfig(logName)
 
 	if gin.IsDebugging() {
 		logLevel = zap.NewAtomicLevelAt(zap.DebugLevel)
@@ -96,7 +103,7 @@ func NewLogger(logName string) *zap.Logger {
 
 		// debug 日志输出至日志文件、标准输出
 		core = zapcore.NewTee(
-			zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zap.CombineWriteSyncers(fileWriters...), logLevel),
+			zapcore.NewCore(newEncoder(logName, encoder), zap.CombineWriteSyncers(fileWriters...), logLevel),
 			func() zapcore.Core {
 				consoleWriter, closeOut, err := zap.Open("stdout")
 				if err != nil {
@@ -104,15 +111,16 @@ func NewLogger(logName string) *zap.Logger {
 					panic(err)
 				}
 				encoder.EncodeLevel = zapcore.CapitalColorLevelEncoder
-				return zapcore.NewCore(zapcore.NewConsoleEncoder(encoder), zap.CombineWriteSyncers(consoleWriter), logLevel)
+				return zapcore.NewCore(zapcore.NewConsoleEncoder(encoder), countingWriter{consoleWriter, m}, logLevel)
 			}(),
 		)
 	} else {
 		logLevel = zap.NewAtomicLevelAt(zap.InfoLevel)
-		core = zapcore.NewCore(zapcore.NewJSONEncoder(encoder), zap.CombineWriteSyncers(fileWriters...), logLevel)
+		core = zapcore.NewCore(newEncoder(logName, encoder), zap.CombineWriteSyncers(fileWriters...), logLevel)
 	}
 
-	logger := zap.New(core, zap.AddCaller(), zap.AddCallerSkip(1))
+	core = &countingCore{core, m}
+	logger := zap.New(core, append(loggerOptions(logName), zap.Hooks(fireHooks(logName)))...)
 	loggerMap.Store(logName, logger)
 	return logger
 }
@@ -0,0 +1,100 @@
+package logger
+
+import (
+	"io"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"github.com/qkzsky/go-utils/metrics"
+	"go.uber.org/zap/zapcore"
+)
+
+var metricsMap sync.Map
+
+type loggerMetrics struct {
+	levels      [zapcore.FatalLevel - zapcore.DebugLevel + 1]uint64
+	dropped     uint64
+	writeErrors uint64
+}
+
+func init() {
+	metrics.Register("logger", collect)
+}
+
+func getMetrics(logName string) *loggerMetrics {
+	m, _ := metricsMap.LoadOrStore(logName, &loggerMetrics{})
+	return m.(*loggerMetrics)
+}
+
+// countingCore 统计各级别写入条数
+type countingCore struct {
+	zapcore.Core
+	m *loggerMetrics
+}
+
+func (c *countingCore) With(fields []zapcore.Field) zapcore.Core {
+	return &countingCore{c.Core.With(fields), c.m}
+}
+
+func (c *countingCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.Enabled(ent.Level) {
+		return ce
+	}
+	if ent.Level >= zapcore.DebugLevel && ent.Level <= zapcore.FatalLevel {
+		atomic.AddUint64(&c.m.levels[ent.Level-zapcore.DebugLevel], 1)
+	}
+	return c.Core.Check(ent, ce)
+}
+
+// countingWriter 统计写入失败次数
+type countingWriter struct {
+	zapcore.WriteSyncer
+	m *loggerMetrics
+}
+
+func (w countingWriter) Write(p []byte) (int, error) {
+	n, err := w.WriteSyncer.Write(p)
+	if err != nil {
+		atomic.AddUint64(&w.m.writeErrors, 1)
+	}
+	return n, err
+}
+
+func (w countingWriter) Sync() error {
+	err := w.WriteSyncer.Sync()
+	if err != nil {
+		atomic.AddUint64(&w.m.writeErrors, 1)
+	}
+	return err
+}
+
+func collect(w io.Writer) {
+	var names []string
+	all := map[string]*loggerMetrics{}
+	metricsMap.Range(func(key, value interface{}) bool {
+		names = append(names, key.(string))
+		all[key.(string)] = value.(*loggerMetrics)
+		return true
+	})
+	sort.Strings(names)
+
+	metrics.WriteHeader(w, "log_entries_total", "counter", "Log entries written by logger and level.")
+	for _, name := range names {
+		for i := range all[name].levels {
+			level := zapcore.DebugLevel + zapcore.Level(i)
+			metrics.WriteSample(w, "log_entries_total", float64(atomic.LoadUint64(&all[name].levels[i])),
+				"logger", name, "level", level.String())
+		}
+	}
+
+	metrics.WriteHeader(w, "log_dropped_total", "counter", "Log entries lost because a hook failed to deliver them.")
+	for _, name := range names {
+		metrics.WriteSample(w, "log_dropped_total", float64(atomic.LoadUint64(&all[name].dropped)), "logger", name)
+	}
+
+	metrics.WriteHeader(w, "log_write_errors_total", "counter", "Failed writes or syncs of log outputs.")
+	for _, name := range names {
+		metrics.WriteSample(w, "log_write_errors_total", float64(atomic.LoadUint64(&all[name].writeErrors)), "logger", name)
+	}
+}
@@ -0,0 +1,136 @@
+// Package metrics 以 Prometheus text format 暴露各模块注册的指标
+package metrics
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const ContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+// Collector writes its metrics to w in Prometheus text format
+type Collector func(w io.Writer)
+
+var (
+	collectors = map[string]Collector{}
+	mu         sync.RWMutex
+)
+
+// Register adds the collector under name, replacing any collector with the same name
+func Register(name string, c Collector) {
+	mu.Lock()
+	defer mu.Unlock()
+	collectors[name] = c
+}
+
+// Unregister removes the collector
+func Unregister(name string) {
+	mu.Lock()
+	defer mu.Unlock()
+	delete(collectors, name)
+}
+
+// WriteTo writes every registered collector to w, ordered by name
+func WriteTo(w io.Writer) {
+	mu.RLock()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	list := make([]Collector, 0, len(names))
+	sort.Strings(names)
+	for _, name := range names {
+		list = append(list, collectors[name])
+	}
+	mu.RUnlock()
+
+	for _, c := range list {
+		c(w)
+	}
+}
+
+// Handler serves the registered metrics, it can be mounted with pprof.Handle
+func Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var buf bytes.Buffer
+		WriteTo(&buf)
+		w.Header().Set("Content-Type", ContentType)
+		w.Write(buf.Bytes())
+	})
+}
+
+// WriteHeader writes the HELP and TYPE lines of a metric family
+func WriteHeader(w io.Writer, name, typ, help string) {
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, typ)
+}
+
+// WriteSample writes one sample, labels are given as key, value pairs
+func WriteSample(w io.Writer, name string, value float64, labels ...string) {
+	fmt.Fprintf(w, "%s%s %s\n", name, Labels(labels...), strconv.FormatFloat(value, 'g', -1, 64))
+}
+
+var labelReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Labels formats key, value pairs as {k1="v1",k2="v2"}
+func Labels(kv ...string) string {
+	if len(kv) < 2 {
+		return ""
+	}
+
+	var b strings.Builder
+	b.WriteByte('{')
+	for i := 0; i+1 < len(kv); i += 2 {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(kv[i])
+		b.WriteString(`="`)
+		b.WriteString(labelReplacer.Replace(kv[i+1]))
+		b.WriteByte('"')
+	}
+	b.WriteByte('}')
+	return b.String()
+}
+
+var (
+	sources   = map[string]func() interface{}{}
+	sourcesMu sync.RWMutex
+)
+
+// RegisterJSON adds a source served by JSONHandler under name
+func RegisterJSON(name string, source func() interface{}) {
+	sourcesMu.Lock()
+	defer sourcesMu.Unlock()
+	sources[name] = source
+}
+
+// JSONHandler serves every registered source as one JSON object keyed by name,
+// ?name=xxx limits the output to one source
+func JSONHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		sourcesMu.RLock()
+		list := make(map[string]func() interface{}, len(sources))
+		for name, source := range sources {
+			list[name] = source
+		}
+		sourcesMu.RUnlock()
+
+		result := map[string]interface{}{}
+		only := r.URL.Query().Get("name")
+		for name, source := range list {
+			if only == "" || only == name {
+				result[name] = source()
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json; charset=utf-8")
+		json.NewEncoder(w).Encode(result)
+	})
+}
@@ -0,0 +1,453 @@
+// Package migrate 按版本执行目录中的 SQL 迁移文件，已执行版本记录在迁移表中
+//
+// 文件命名：{version}_{name}.up.sql、{version}_{name}.down.sql，version 为数字，通常为创建时间 20060102150405
+package migrate
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils"
+	"github.com/qkzsky/go-utils/database"
+)
+
+const (
+	DefaultTable       = "schema_migrations"
+	DefaultLockTimeout = time.Minute
+)
+
+var fileRegexp = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is one version found in the directory
+type Migration struct {
+	Version int64
+	Name    string
+	Up      string // file path
+	Down    string // file path
+}
+
+// Status of a migration, AppliedAt is zero if not applied
+type Status struct {
+	Migration
+	Applied   bool
+	AppliedAt time.Time
+}
+
+// Migrator applies migrations of Dir to DB, DB may be bound by database.WithContext but not be a transaction
+type Migrator struct {
+	DB          *gorm.DB
+	Dir         string
+	Table       string
+	LockTimeout time.Duration
+	DryRun      bool      // 只输出将执行的 SQL，不执行
+	Out         io.Writer // 执行过程及 dry-run 输出，默认 os.Stdout
+}
+
+// New returns a Migrator for the handle opened by database.Open(databaseName)
+func New(databaseName, dir string) (*Migrator, error) {
+	db, err := database.Open(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Migrator{
+		DB:          db,
+		Dir:         dir,
+		Table:       DefaultTable,
+		LockTimeout: DefaultLockTimeout,
+		Out:         os.Stdout,
+	}, nil
+}
+
+func (m *Migrator) printf(format string, a ...interface{}) {
+	out := m.Out
+	if out == nil {
+		out = os.Stdout
+	}
+	fmt.Fprintf(out, format, a...)
+}
+
+// sqlDB 返回 DB 的连接池，WithContext 绑定的句柄 DB() 为 nil，经 database.SQLDB 取得
+func (m *Migrator) sqlDB() (*sql.DB, error) {
+	if db := database.SQLDB(m.DB); db != nil {
+		return db, nil
+	}
+	return nil, fmt.Errorf("migrate: DB is a transaction, migrations run their own transactions")
+}
+
+func (m *Migrator) dialect() string {
+	return m.DB.Dialect().GetName()
+}
+
+func (m *Migrator) placeholder(n int) string {
+	if m.dialect() == "postgres" {
+		return "$" + strconv.Itoa(n)
+	}
+	return "?"
+}
+
+// Migrations returns the migrations found in Dir ordered by version
+func (m *Migrator) Migrations() ([]Migration, error) {
+	infos, err := ioutil.ReadDir(m.Dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := map[int64]*Migration{}
+	for _, info := range infos {
+		matches := fileRegexp.FindStringSubmatch(info.Name())
+		if info.IsDir() || matches == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(matches[1], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("migrate: %s: %v", info.Name(), err)
+		}
+
+		mg, ok := byVersion[version]
+		if !ok {
+			mg = &Migration{Version: version, Name: matches[2]}
+			byVersion[version] = mg
+		} else if mg.Name != matches[2] {
+			return nil, fmt.Errorf("migrate: version %d used by %s and %s", version, mg.Name, matches[2])
+		}
+
+		path := filepath.Join(m.Dir, info.Name())
+		if matches[3] == "up" {
+			mg.Up = path
+		} else {
+			mg.Down = path
+		}
+	}
+
+	list := make([]Migration, 0, len(byVersion))
+	for _, mg := range byVersion {
+		list = append(list, *mg)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+func (m *Migrator) ensureTable(ctx context.Context) error {
+	db, err := m.sqlDB()
+	if err != nil {
+		return err
+	}
+	_, err = db.ExecContext(ctx, "CREATE TABLE IF NOT EXISTS "+m.Table+" ("+
+		"version BIGINT NOT NULL PRIMARY KEY, "+
+		"name VARCHAR(255) NOT NULL, "+
+		"applied_at TIMESTAMP NOT NULL)")
+	return err
+}
+
+func (m *Migrator) applied(ctx context.Context) (map[int64]time.Time, error) {
+	db, err := m.sqlDB()
+	if err != nil {
+		return nil, err
+	}
+	result := map[int64]time.Time{}
+	rows, err := db.QueryContext(ctx, "SELECT version, applied_at FROM "+m.Table)
+	if err != nil {
+		// dry-run 时迁移表可能尚未创建
+		if m.DryRun {
+			return result, nil
+		}
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var (
+			version   int64
+			appliedAt time.Time
+		)
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		result[version] = appliedAt
+	}
+	return result, rows.Err()
+}
+
+// Status lists every migration in Dir together with versions recorded in the table but missing from Dir
+func (m *Migrator) Status(ctx context.Context) ([]Status, error) {
+	migrations, err := m.Migrations()
+	if err != nil {
+		return nil, err
+	}
+	if !m.DryRun {
+		if err := m.ensureTable(ctx); err != nil {
+			return nil, err
+		}
+	}
+	applied, err := m.applied(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var list []Status
+	for _, mg := range migrations {
+		at, ok := applied[mg.Version]
+		list = append(list, Status{Migration: mg, Applied: ok, AppliedAt: at})
+		delete(applied, mg.Version)
+	}
+	for version, at := range applied {
+		list = append(list, Status{Migration: Migration{Version: version, Name: "<missing>"}, Applied: true, AppliedAt: at})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Version < list[j].Version })
+	return list, nil
+}
+
+// Up applies pending migrations in order, at most steps of them if steps > 0
+func (m *Migrator) Up(ctx context.Context, steps int) error {
+	return m.run(ctx, func(list []Status) error {
+		n := 0
+		for _, st := range list {
+			if st.Applied {
+				continue
+			}
+			if steps > 0 && n >= steps {
+				break
+			}
+			if st.Up == "" {
+				return fmt.Errorf("migrate: version %d has no up file", st.Version)
+			}
+			if err := m.apply(ctx, st.Migration, st.Up, true); err != nil {
+				return err
+			}
+			n++
+		}
+		if n == 0 {
+			m.printf("no pending migrations\n")
+		}
+		return nil
+	})
+}
+
+// Down rolls back the latest applied migrations, steps defaults to 1
+func (m *Migrator) Down(ctx context.Context, steps int) error {
+	if steps <= 0 {
+		steps = 1
+	}
+	return m.run(ctx, func(list []Status) error {
+		n := 0
+		for i := len(list) - 1; i >= 0 && n < steps; i-- {
+			st := list[i]
+			if !st.Applied {
+				continue
+			}
+			if st.Down == "" {
+				return fmt.Errorf("migrate: version %d has no down file", st.Version)
+			}
+			if err := m.apply(ctx, st.Migration, st.Down, false); err != nil {
+				return err
+			}
+			n++
+		}
+		if n == 0 {
+			m.printf("no applied migrations\n")
+		}
+		return nil
+	})
+}
+
+// run 持有锁期间读取状态并执行 fn，dry-run 不加锁
+func (m *Migrator) run(ctx context.Context, fn func(list []Status) error) error {
+	if !m.DryRun {
+		unlock, err := m.lock(ctx)
+		if err != nil {
+			return err
+		}
+		defer unlock()
+	}
+
+	list, err := m.Status(ctx)
+	if err != nil {
+		return err
+	}
+	return fn(list)
+}
+
+func (m *Migrator) apply(ctx context.Context, mg Migration, file string, up bool) error {
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	statements := SplitStatements(string(content))
+
+	var (
+		record    string
+		args      []interface{}
+		direction = "down"
+	)
+	if up {
+		direction = "up"
+		record = fmt.Sprintf("INSERT INTO %s (version, name, applied_at) VALUES (%s, %s, %s)",
+			m.Table, m.placeholder(1), m.placeholder(2), m.placeholder(3))
+		args = []interface{}{mg.Version, mg.Name, time.Now()}
+	} else {
+		record = fmt.Sprintf("DELETE FROM %s WHERE version = %s", m.Table, m.placeholder(1))
+		args = []interface{}{mg.Version}
+	}
+
+	m.printf("-- %s %d_%s\n", direction, mg.Version, mg.Name)
+	if m.DryRun {
+		for _, stmt := range statements {
+			m.printf("%s;\n", stmt)
+		}
+		m.printf("%s; -- version %d\n", record, mg.Version)
+		return nil
+	}
+
+	// MySQL 的 DDL 会隐式提交，事务只保证 DML 与版本记录一致
+	db, err := m.sqlDB()
+	if err != nil {
+		return err
+	}
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	for _, stmt := range statements {
+		if _, err := tx.ExecContext(ctx, stmt); err != nil {
+			tx.Rollback()
+			return fmt.Errorf("migrate: %s: %v", filepath.Base(file), err)
+		}
+	}
+	if _, err := tx.ExecContext(ctx, record, args...); err != nil {
+		tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// lock 取得以迁移表命名的 database.Lock，MySQL、PostgreSQL 连接断开时自动释放
+func (m *Migrator) lock(ctx context.Context) (func(), error) {
+	timeout := m.LockTimeout
+	if timeout <= 0 {
+		timeout = DefaultLockTimeout
+	}
+	lockCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	l, err := database.Lock(lockCtx, m.DB, m.Table, 0)
+	if err != nil {
+		return nil, fmt.Errorf("migrate: lock %s: %v", m.Table, err)
+	}
+	return func() {
+		l.Unlock()
+	}, nil
+}
+
+// Create writes empty up and down files for a new version named by the current time
+func Create(dir, name string) (up, down string, err error) {
+	name = strings.Trim(regexp.MustCompile(`[^a-zA-Z0-9]+`).ReplaceAllString(strings.ToLower(name), "_"), "_")
+	if name == "" {
+		return "", "", fmt.Errorf("migrate: empty name")
+	}
+	if err = os.MkdirAll(dir, os.ModePerm); err != nil {
+		return "", "", err
+	}
+
+	version := time.Now().Format("20060102150405")
+	up = filepath.Join(dir, version+"_"+name+".up.sql")
+	down = filepath.Join(dir, version+"_"+name+".down.sql")
+	for _, file := range []string{up, down} {
+		if utils.FileExists(file) {
+			return "", "", fmt.Errorf("migrate: %s already exists", file)
+		}
+		if err = ioutil.WriteFile(file, []byte("-- "+filepath.Base(file)+"\n"), 0644); err != nil {
+			return "", "", err
+		}
+	}
+	return up, down, nil
+}
+
+// SplitStatements splits SQL on semicolons outside quotes, PostgreSQL dollar-quoted bodies ($$ ... $$,
+// $tag$ ... $tag$) and comments, empty statements are dropped. A backslash escapes the next character
+// inside single and double quoted strings as in MySQL, so PostgreSQL strings ending with a backslash
+// should be written with dollar quoting
+func SplitStatements(content string) []string {
+	var (
+		list  []string
+		cur   strings.Builder
+		quote rune
+	)
+	runes := []rune(content)
+	for i := 0; i < len(runes); i++ {
+		r := runes[i]
+		switch {
+		case quote != 0:
+			cur.WriteRune(r)
+			if r == '\\' && quote != '`' && i+1 < len(runes) {
+				i++
+				cur.WriteRune(runes[i])
+			} else if r == quote {
+				quote = 0
+			}
+		case r == '\'' || r == '"' || r == '`':
+			quote = r
+			cur.WriteRune(r)
+		case r == '$' && dollarQuoted(runes[i:]) > 0:
+			// 函数、触发器体原样保留
+			n := dollarQuoted(runes[i:])
+			cur.WriteString(string(runes[i : i+n]))
+			i += n - 1
+		case r == '-' && i+1 < len(runes) && runes[i+1] == '-':
+			for i < len(runes) && runes[i] != '\n' {
+				i++
+			}
+			cur.WriteRune('\n')
+		case r == '/' && i+1 < len(runes) && runes[i+1] == '*':
+			for i += 2; i+1 < len(runes) && !(runes[i] == '*' && runes[i+1] == '/'); i++ {
+			}
+			i++
+		case r == ';':
+			if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+				list = append(list, stmt)
+			}
+			cur.Reset()
+		default:
+			cur.WriteRune(r)
+		}
+	}
+	if stmt := strings.TrimSpace(cur.String()); stmt != "" {
+		list = append(list, stmt)
+	}
+	return list
+}
+
+// dollarQuoted returns the length of the $tag$ ... $tag$ string at the start of runes, 0 if runes does not
+// start with a dollar quote. An unterminated string runs to the end
+func dollarQuoted(runes []rune) int {
+	tag := 1
+	for ; tag < len(runes) && runes[tag] != '$'; tag++ {
+		r := runes[tag]
+		if r != '_' && !unicode.IsLetter(r) && (tag == 1 || !unicode.IsDigit(r)) {
+			return 0
+		}
+	}
+	if tag >= len(runes) {
+		return 0
+	}
+
+	delim := string(runes[:tag+1])
+	rest := string(runes[tag+1:])
+	end := strings.Index(rest, delim)
+	if end < 0 {
+		return len(runes)
+	}
+	return 2*(tag+1) + utf8.RuneCountInString(rest[:end])
+}
@@ -0,0 +1,73 @@
+package migrate
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/qkzsky/go-utils/database"
+)
+
+func TestSplitStatements(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+		want    []string
+	}{
+		{"simple", "CREATE TABLE a (id int);\nCREATE TABLE b (id int);\n", []string{"CREATE TABLE a (id int)", "CREATE TABLE b (id int)"}},
+		{"no trailing semicolon", "SELECT 1", []string{"SELECT 1"}},
+		{"empty statements", ";;\n ; SELECT 1;;", []string{"SELECT 1"}},
+		{"quotes", "INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`);", []string{"INSERT INTO t VALUES ('a;b', \"c;d\", `e;f`)"}},
+		{"doubled quote", "INSERT INTO t VALUES ('it''s;');SELECT 1", []string{"INSERT INTO t VALUES ('it''s;')", "SELECT 1"}},
+		{"backslash escape", `INSERT INTO t VALUES ('it\'s; ok', "a\";");SELECT 1`, []string{`INSERT INTO t VALUES ('it\'s; ok', "a\";")`, "SELECT 1"}},
+		{"comments", "-- first; comment\nSELECT 1; /* block; */ SELECT 2;", []string{"SELECT 1", "SELECT 2"}},
+		{"dollar quoted", "CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.a := 'x;'; -- keep\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;\nSELECT 1;",
+			[]string{"CREATE FUNCTION f() RETURNS trigger AS $$\nBEGIN\n  NEW.a := 'x;'; -- keep\n  RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql", "SELECT 1"}},
+		{"tagged dollar quote", "DO $body$ BEGIN PERFORM 1; END $body$; SELECT $1", []string{"DO $body$ BEGIN PERFORM 1; END $body$", "SELECT $1"}},
+		{"unterminated dollar quote", "SELECT $$a;b", []string{"SELECT $$a;b"}},
+		{"multibyte", "SELECT 'é;', $x$ ü; $x$; SELECT 2", []string{"SELECT 'é;', $x$ ü; $x$", "SELECT 2"}},
+	}
+	for _, tt := range tests {
+		if got := SplitStatements(tt.content); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: SplitStatements = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestMigratorHandles(t *testing.T) {
+	db, err := database.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir, err := ioutil.TempDir("", "migrate")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := ioutil.WriteFile(filepath.Join(dir, "1_init.up.sql"), []byte("CREATE TABLE migrate_handles (id INTEGER)"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DropTableIfExists("migrate_handles", "migrate_handles_versions")
+
+	// WithContext 绑定的句柄 DB() 为 nil，由 database.SQLDB 取得连接池
+	ctx := context.Background()
+	m := &Migrator{DB: database.WithContext(ctx, db), Dir: dir, Table: "migrate_handles_versions", Out: ioutil.Discard}
+	if err := m.Up(ctx, 0); err != nil {
+		t.Fatal(err)
+	}
+	list, err := m.Status(ctx)
+	if err != nil || len(list) != 1 || !list[0].Applied {
+		t.Fatalf("Status = %+v, %v", list, err)
+	}
+
+	// 事务句柄返回错误而不是 panic
+	tx := db.Begin()
+	defer tx.Rollback()
+	m.DB = tx
+	if _, err := m.Status(ctx); err == nil {
+		t.Error("Status on a transaction succeeded")
+	}
+}
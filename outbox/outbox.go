@@ -0,0 +1,275 @@
+// Package outbox 事务性发件箱：事件与业务数据在同一事务中写入 outbox 表，由 Relay 投递至 Publisher，
+// 保证业务提交后事件至少投递一次，同一 aggregate 的事件按写入顺序投递
+package outbox
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/jinzhu/gorm"
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/database"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	DefaultTable       = "outbox_events"
+	DefaultBatchSize   = 100
+	DefaultInterval    = time.Second
+	DefaultMaxAttempts = 10
+	DefaultBackoff     = time.Second
+	DefaultMaxBackoff  = 5 * time.Minute
+	DefaultRetention   = 7 * 24 * time.Hour
+
+	cleanupInterval = time.Minute
+	maxErrorLength  = 1024
+)
+
+var outboxConf *ini.Section
+
+func init() {
+	outboxConf = config.Section("outbox")
+}
+
+// Table returns the configured outbox table, [outbox] table
+func Table() string {
+	return outboxConf.Key("table").MustString(DefaultTable)
+}
+
+// Event is a row of the outbox table
+type Event struct {
+	ID            uint64     `gorm:"primary_key" json:"id"`
+	Topic         string     `gorm:"size:191;not null" json:"topic"`
+	Aggregate     string     `gorm:"size:191;not null;index" json:"aggregate"` // 同一 aggregate 的事件按 ID 顺序投递
+	Payload       string     `gorm:"type:text" json:"-"`
+	Attempts      int        `gorm:"not null;default:0" json:"attempts"`
+	NextAttemptAt time.Time  `gorm:"index" json:"-"`
+	LastError     string     `gorm:"size:1024" json:"-"`
+	PublishedAt   *time.Time `gorm:"index" json:"-"`
+	CreatedAt     time.Time  `json:"created_at"`
+}
+
+// AutoMigrate creates or updates the outbox table
+func AutoMigrate(db *gorm.DB) error {
+	return db.Table(Table()).AutoMigrate(&Event{}).Error
+}
+
+// Publish 在 tx 中写入一条事件，payload 序列化为 JSON；tx 提交后由 Relay 投递，回滚则事件一同丢弃
+//
+//	err := database.WithTx(ctx, db, nil, func(tx *gorm.DB) error {
+//		if err := tx.Create(&order).Error; err != nil {
+//			return err
+//		}
+//		return outbox.Publish(tx, "order.created", "order:"+id, order)
+//	})
+func Publish(tx *gorm.DB, topic, aggregate string, payload interface{}) error {
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	e := &Event{
+		Topic:         topic,
+		Aggregate:     aggregate,
+		Payload:       string(data),
+		NextAttemptAt: now,
+		CreatedAt:     now,
+	}
+	return tx.Table(Table()).Create(e).Error
+}
+
+// Relay delivers pending events to Publisher
+type Relay struct {
+	DB          *gorm.DB
+	Publisher   Publisher
+	Table       string
+	BatchSize   int
+	Interval    time.Duration // 无待投递事件时的轮询间隔
+	MaxAttempts int           // 达到次数后不再投递，同一 aggregate 的后续事件随之阻塞，0 不限制
+	Backoff     time.Duration
+	MaxBackoff  time.Duration
+	Retention   time.Duration // 已投递事件的保留时间，0 不清理
+
+	lastCleanup time.Time
+}
+
+// NewRelay returns a Relay for database.Open(databaseName) configured by [outbox]
+func NewRelay(databaseName string, publisher Publisher) (*Relay, error) {
+	db, err := database.Open(databaseName)
+	if err != nil {
+		return nil, err
+	}
+	return &Relay{
+		DB:          db,
+		Publisher:   publisher,
+		Table:       Table(),
+		BatchSize:   outboxConf.Key("batch_size").MustInt(DefaultBatchSize),
+		Interval:    outboxConf.Key("interval").MustDuration(DefaultInterval),
+		MaxAttempts: outboxConf.Key("max_attempts").MustInt(DefaultMaxAttempts),
+		Backoff:     outboxConf.Key("backoff").MustDuration(DefaultBackoff),
+		MaxBackoff:  outboxConf.Key("max_backoff").MustDuration(DefaultMaxBackoff),
+		Retention:   outboxConf.Key("retention").MustDuration(DefaultRetention),
+	}, nil
+}
+
+// Run 持续投递直至 ctx 结束；多实例部署时通过 database.TryLock 只有一个实例投递，其余实例等待接替
+func (r *Relay) Run(ctx context.Context) error {
+	interval := r.Interval
+	if interval <= 0 {
+		interval = DefaultInterval
+	}
+
+	for {
+		l, err := database.TryLock(ctx, r.DB, "outbox:"+r.Table, 0)
+		if err == nil {
+			err = r.lead(ctx, l, interval)
+			l.Unlock()
+		} else if !errors.Is(err, database.ErrLocked) {
+			log.Println("[outbox] lock: " + err.Error())
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(interval):
+		}
+	}
+}
+
+// lead 持锁期间循环投递，锁丢失时返回
+func (r *Relay) lead(ctx context.Context, l *database.LockHandle, interval time.Duration) error {
+	for {
+		n, err := r.Process(ctx)
+		if err != nil {
+			log.Println("[outbox] " + err.Error())
+		}
+
+		// 本批已满时立即处理下一批
+		wait := interval
+		if err == nil && n >= r.batchSize() {
+			wait = 0
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-l.Lost():
+			return fmt.Errorf("outbox: lock lost")
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (r *Relay) batchSize() int {
+	if r.BatchSize <= 0 {
+		return DefaultBatchSize
+	}
+	return r.BatchSize
+}
+
+// Process 投递一批到期事件，返回取出的事件数；同一 aggregate 的事件按 id 顺序在同一批中投递，
+// 某事件投递失败时该 aggregate 的后续事件留待下次
+func (r *Relay) Process(ctx context.Context) (int, error) {
+	db := database.WithContext(ctx, r.DB)
+	table := db.Dialect().Quote(r.Table)
+	now := time.Now()
+
+	// 同一 aggregate 存在更早的、本次不能投递（退避中或已放弃）的事件时跳过，保证顺序
+	blocking, args := "p.next_attempt_at > ?", []interface{}{now}
+	if r.MaxAttempts > 0 {
+		blocking, args = "(p.next_attempt_at > ? OR p.attempts >= ?)", append(args, r.MaxAttempts)
+	}
+	query := db.Table(r.Table+" AS e").
+		Where("e.published_at IS NULL AND e.next_attempt_at <= ?", now).
+		Where("NOT EXISTS (SELECT 1 FROM "+table+" p WHERE p.aggregate = e.aggregate AND p.published_at IS NULL AND p.id < e.id AND "+blocking+")", args...)
+	if r.MaxAttempts > 0 {
+		query = query.Where("e.attempts < ?", r.MaxAttempts)
+	}
+
+	var events []*Event
+	if err := query.Select("e.*").Order("e.id").Limit(r.batchSize()).Find(&events).Error; err != nil {
+		return 0, err
+	}
+
+	failed := map[string]bool{}
+	for _, e := range events {
+		if ctx.Err() != nil {
+			return len(events), ctx.Err()
+		}
+		if failed[e.Aggregate] {
+			continue
+		}
+
+		err := r.Publisher.Publish(ctx, e)
+		if err == nil {
+			err = db.Table(r.Table).Where("id = ?", e.ID).
+				Updates(map[string]interface{}{"published_at": time.Now(), "attempts": e.Attempts + 1, "last_error": ""}).Error
+			if err != nil {
+				return len(events), err
+			}
+			continue
+		}
+
+		failed[e.Aggregate] = true
+		e.Attempts++
+		msg := truncateError(err.Error())
+		if r.MaxAttempts > 0 && e.Attempts >= r.MaxAttempts {
+			log.Printf("[outbox] event %d (%s %s) gave up after %d attempts, aggregate blocked: %s", e.ID, e.Topic, e.Aggregate, e.Attempts, msg)
+		}
+		err = db.Table(r.Table).Where("id = ?", e.ID).
+			Updates(map[string]interface{}{"attempts": e.Attempts, "next_attempt_at": time.Now().Add(r.backoff(e.Attempts)), "last_error": msg}).Error
+		if err != nil {
+			return len(events), err
+		}
+	}
+
+	if err := r.cleanup(db); err != nil {
+		return len(events), err
+	}
+	return len(events), nil
+}
+
+// backoff returns Backoff * 2^(attempts-1) capped by MaxBackoff
+func (r *Relay) backoff(attempts int) time.Duration {
+	backoff, max := r.Backoff, r.MaxBackoff
+	if backoff <= 0 {
+		backoff = DefaultBackoff
+	}
+	if max <= 0 {
+		max = DefaultMaxBackoff
+	}
+	for i := 1; i < attempts && backoff < max; i++ {
+		backoff *= 2
+	}
+	if backoff > max {
+		backoff = max
+	}
+	return backoff
+}
+
+// cleanup 每分钟至多一次删除超过保留时间的已投递事件
+func (r *Relay) cleanup(db *gorm.DB) error {
+	if r.Retention <= 0 || time.Since(r.lastCleanup) < cleanupInterval {
+		return nil
+	}
+	r.lastCleanup = time.Now()
+	return db.Table(r.Table).Where("published_at < ?", time.Now().Add(-r.Retention)).Delete(&Event{}).Error
+}
+
+// truncateError 截断至 maxErrorLength 字节，不截断多字节字符并替换无效的 UTF-8，否则 PostgreSQL 拒绝写入 last_error
+func truncateError(msg string) string {
+	msg = strings.ToValidUTF8(msg, "\uFFFD")
+	if len(msg) <= maxErrorLength {
+		return msg
+	}
+	end := maxErrorLength
+	for end > 0 && !utf8.RuneStart(msg[end]) {
+		end--
+	}
+	return msg[:end]
+}
@@ -0,0 +1,106 @@
+package outbox
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/qkzsky/go-utils/database"
+)
+
+func TestProcessOrder(t *testing.T) {
+	db, err := database.Open("test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := AutoMigrate(db); err != nil {
+		t.Fatal(err)
+	}
+	defer db.DropTable(Table())
+
+	for _, p := range []struct{ aggregate, payload string }{{"a", "1"}, {"a", "2"}, {"b", "1"}, {"a", "3"}, {"b", "2"}} {
+		if err := Publish(db, "topic", p.aggregate, p.payload); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var published []string
+	failed := false
+	r := &Relay{DB: db, Table: Table(), BatchSize: 100, MaxAttempts: 3, Backoff: 20 * time.Millisecond,
+		Publisher: PublisherFunc(func(ctx context.Context, e *Event) error {
+			key := e.Aggregate + string(e.Payload)
+			if key == `a"2"` && !failed {
+				failed = true
+				return errors.New("unavailable")
+			}
+			published = append(published, key)
+			return nil
+		})}
+
+	// 一次处理中投递各 aggregate 的全部到期事件，a 在失败处停止
+	if _, err := r.Process(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if want := []string{`a"1"`, `b"1"`, `b"2"`}; !reflect.DeepEqual(published, want) {
+		t.Fatalf("first pass = %v, want %v", published, want)
+	}
+
+	// 退避期间 a 的后续事件不投递
+	published = nil
+	r.Process(context.Background())
+	if len(published) != 0 {
+		t.Fatalf("during backoff = %v, want none", published)
+	}
+
+	time.Sleep(30 * time.Millisecond)
+	r.Process(context.Background())
+	if want := []string{`a"2"`, `a"3"`}; !reflect.DeepEqual(published, want) {
+		t.Fatalf("after backoff = %v, want %v", published, want)
+	}
+}
+
+func TestTruncateError(t *testing.T) {
+	long := strings.Repeat("a", maxErrorLength-1) + "错误"
+	for _, msg := range []string{"short", long, strings.Repeat("错", maxErrorLength), "bad \xff byte"} {
+		got := truncateError(msg)
+		if len(got) > maxErrorLength || !utf8.ValidString(got) {
+			t.Errorf("truncateError(%.20q) = %d bytes, valid %v", msg, len(got), utf8.ValidString(got))
+		}
+	}
+	if got := truncateError(long); got != strings.Repeat("a", maxErrorLength-1) {
+		t.Errorf("truncateError split a rune: %q", got[len(got)-4:])
+	}
+}
+
+func TestHTTPPublisherContext(t *testing.T) {
+	release := make(chan struct{})
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("X-Outbox-Id") != "1" {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}))
+	defer srv.Close()
+	defer close(release)
+
+	p := NewHTTPPublisher(srv.URL, time.Minute)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	if err := p.Publish(ctx, &Event{ID: 1, Topic: "topic", Payload: `{}`}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("Publish err = %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("Publish ignored ctx, took %v", elapsed)
+	}
+}
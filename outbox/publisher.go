@@ -0,0 +1,103 @@
+package outbox
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/qkzsky/go-utils/config"
+)
+
+// Publisher delivers one event, an error schedules a retry. Delivery is at least once,
+// consumers should deduplicate by event id
+type Publisher interface {
+	Publish(ctx context.Context, e *Event) error
+}
+
+// PublisherFunc adapts a function to Publisher
+type PublisherFunc func(ctx context.Context, e *Event) error
+
+func (f PublisherFunc) Publish(ctx context.Context, e *Event) error {
+	return f(ctx, e)
+}
+
+// Message is the body sent by the built-in publishers
+type Message struct {
+	ID        uint64          `json:"id"`
+	App       string          `json:"app"`
+	Topic     string          `json:"topic"`
+	Aggregate string          `json:"aggregate"`
+	Payload   json.RawMessage `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// NewMessage returns the Message of e
+func NewMessage(e *Event) Message {
+	return Message{
+		ID:        e.ID,
+		App:       config.AppName,
+		Topic:     e.Topic,
+		Aggregate: e.Aggregate,
+		Payload:   json.RawMessage(e.Payload),
+		CreatedAt: e.CreatedAt,
+	}
+}
+
+// NewHTTPPublisher POST 事件 Message 至 url，2xx 视为成功，请求头 X-Outbox-Id 可用于去重；
+// ctx 取消（如 Relay 关闭）时中断请求
+func NewHTTPPublisher(url string, timeout time.Duration) Publisher {
+	client := &http.Client{Timeout: timeout}
+	return PublisherFunc(func(ctx context.Context, e *Event) error {
+		body, err := json.Marshal(NewMessage(e))
+		if err != nil {
+			return err
+		}
+		req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Outbox-Id", strconv.FormatUint(e.ID, 10))
+		req.Header.Set("X-Outbox-Topic", e.Topic)
+
+		resp, err := client.Do(req)
+		if err != nil {
+			return err
+		}
+		defer resp.Body.Close()
+		io.Copy(ioutil.Discard, resp.Body)
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("outbox: %s response %s", url, resp.Status)
+		}
+		return nil
+	})
+}
+
+// NewRedisPublisher XADD 事件至 stream，stream 为空时使用事件的 topic；maxLen 大于 0 时近似裁剪 stream
+func NewRedisPublisher(client redis.Cmdable, stream string, maxLen int64) Publisher {
+	return PublisherFunc(func(ctx context.Context, e *Event) error {
+		name := stream
+		if name == "" {
+			name = e.Topic
+		}
+		return client.XAdd(&redis.XAddArgs{
+			Stream:       name,
+			MaxLenApprox: maxLen,
+			Values: map[string]interface{}{
+				"id":         e.ID,
+				"app":        config.AppName,
+				"topic":      e.Topic,
+				"aggregate":  e.Aggregate,
+				"payload":    e.Payload,
+				"created_at": e.CreatedAt.Format(time.RFC3339Nano),
+			},
+		}).Err()
+	})
+}
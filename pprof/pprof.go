@@ -11,6 +11,13 @@ const (
 	DefaultPrefix = "/debug/pprof"
 )
 
+var handlers = map[string]http.Handler{}
+
+// Handle registers an extra handler (e.g. metrics) served by the next Listen
+func Handle(pattern string, handler http.Handler) {
+	handlers[pattern] = handler
+}
+
 func getPrefix(prefixOptions ...string) string {
 	prefix := DefaultPrefix
 	if len(prefixOptions) > 0 && len(prefixOptions[0]) > 0 {
@@ -34,6 +41,9 @@ func Listen(addr string, prefixOptions ...string) {
 	mux.Handle(prefix+"/symbol", http.HandlerFunc(pprof.Symbol))
 	mux.Handle(prefix+"/threadcreate", pprof.Handler("threadcreate"))
 	mux.Handle(prefix+"/trace", http.HandlerFunc(pprof.Trace))
+	for pattern, handler := range handlers {
+		mux.Handle(pattern, handler)
+	}
 
 	srv := http.Server{
 		Addr:    addr,
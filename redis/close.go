@@ -0,0 +1,45 @@
+package redis
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/qkzsky/go-utils/shutdown"
+)
+
+func init() {
+	shutdown.Register("redis", CloseAllContext)
+}
+
+// CloseAll closes every client created by NewRedis, waiting up to shutdown.DefaultTimeout for in-flight commands
+func CloseAll() error {
+	ctx, cancel := context.WithTimeout(context.Background(), shutdown.DefaultTimeout)
+	defer cancel()
+	return CloseAllContext(ctx)
+}
+
+// CloseAllContext is like CloseAll but waits for in-flight commands until ctx is done
+func CloseAllContext(ctx context.Context) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	var errs shutdown.Errors
+	redisMap.Range(func(key, value interface{}) bool {
+		redisMap.Delete(key)
+		client := value.(redis.UniversalClient)
+
+		err := shutdown.WaitIdle(ctx, func() int {
+			stats := poolStats(client)
+			return int(stats.TotalConns) - int(stats.IdleConns)
+		})
+		if e := client.Close(); e != nil && err == nil {
+			err = e
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("redis %s: %v", key, err))
+		}
+		return true
+	})
+	return errs.Err()
+}
@@ -0,0 +1,75 @@
+package redis
+
+import (
+	"io"
+	"sort"
+
+	"github.com/go-redis/redis/v7"
+	"github.com/qkzsky/go-utils/metrics"
+)
+
+// PoolStat 连接池状态，Name 为 [redis] 配置名
+type PoolStat struct {
+	Name       string `json:"name"`
+	Hits       uint32 `json:"hits"`
+	Misses     uint32 `json:"misses"`
+	Timeouts   uint32 `json:"timeouts"`
+	TotalConns uint32 `json:"total_conns"`
+	IdleConns  uint32 `json:"idle_conns"`
+	StaleConns uint32 `json:"stale_conns"`
+}
+
+func init() {
+	metrics.Register("redis", collectPoolStats)
+	metrics.RegisterJSON("redis", func() interface{} {
+		return PoolStats()
+	})
+}
+
+// PoolStats returns the pool state of every client created by NewRedis, ordered by name
+func PoolStats() []PoolStat {
+	var list []PoolStat
+	redisMap.Range(func(key, value interface{}) bool {
+		s := poolStats(value.(redis.UniversalClient))
+		list = append(list, PoolStat{
+			Name:       key.(string),
+			Hits:       s.Hits,
+			Misses:     s.Misses,
+			Timeouts:   s.Timeouts,
+			TotalConns: s.TotalConns,
+			IdleConns:  s.IdleConns,
+			StaleConns: s.StaleConns,
+		})
+		return true
+	})
+	sort.Slice(list, func(i, j int) bool { return list[i].Name < list[j].Name })
+	return list
+}
+
+func collectPoolStats(w io.Writer) {
+	list := PoolStats()
+	gauges := []struct {
+		name, typ, help string
+		value           func(s PoolStat) uint32
+	}{
+		{"redis_pool_hits_total", "counter", "Times a free connection was found in the pool.",
+			func(s PoolStat) uint32 { return s.Hits }},
+		{"redis_pool_misses_total", "counter", "Times a free connection was not found in the pool.",
+			func(s PoolStat) uint32 { return s.Misses }},
+		{"redis_pool_timeouts_total", "counter", "Times a wait timeout occurred.",
+			func(s PoolStat) uint32 { return s.Timeouts }},
+		{"redis_pool_total_connections", "gauge", "Total connections in the pool.",
+			func(s PoolStat) uint32 { return s.TotalConns }},
+		{"redis_pool_idle_connections", "gauge", "Idle connections in the pool.",
+			func(s PoolStat) uint32 { return s.IdleConns }},
+		{"redis_pool_stale_connections_total", "counter", "Stale connections removed from the pool.",
+			func(s PoolStat) uint32 { return s.StaleConns }},
+	}
+
+	for _, g := range gauges {
+		metrics.WriteHeader(w, g.name, g.typ, g.help)
+		for _, s := range list {
+			metrics.WriteSample(w, g.name, float64(g.value(s)), "name", s.Name)
+		}
+	}
+}
@@ -1,7 +1,9 @@
 package redis
 
 import (
+	"context"
 	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/health"
 	"gopkg.in/ini.v1"
 	"log"
 	"runtime"
@@ -11,6 +13,12 @@ import (
 	"github.com/go-redis/redis/v7"
 )
 
+const (
+	ModeSingle   = "single"
+	ModeSentinel = "sentinel"
+	ModeCluster  = "cluster"
+)
+
 const (
 	DefaultConnectTimeout = 100 * time.Millisecond
 	DefaultReadTimeout    = 1000 * time.Millisecond
@@ -32,23 +40,30 @@ func init() {
 	redisConf = config.Section("redis")
 }
 
-func NewRedis(redisName string) *redis.Client {
+// NewRedis 按 [redis] name.mode 创建并缓存客户端：single 使用 host、port，
+// sentinel 使用 addrs（哨兵地址）、master_name、sentinel_password，cluster 使用 addrs（种子节点）
+func NewRedis(redisName string) redis.UniversalClient {
 	if client, ok := redisMap.Load(redisName); ok {
-		return client.(*redis.Client)
+		return client.(redis.UniversalClient)
 	}
 
 	mu.Lock()
 	defer mu.Unlock()
 	if client, ok := redisMap.Load(redisName); ok {
-		return client.(*redis.Client)
+		return client.(redis.UniversalClient)
 	}
 
 	var err error
+	mode := redisConf.Key(redisName + ".mode").MustString(ModeSingle)
+	if mode != ModeSingle && mode != ModeSentinel && mode != ModeCluster {
+		panic("redis config " + redisName + ".mode unknown: " + mode)
+	}
 	host := redisConf.Key(redisName + ".host").String()
 	port := redisConf.Key(redisName + ".port").String()
 	auth := redisConf.Key(redisName + ".auth").String()
+	addrs := redisConf.Key(redisName + ".addrs").Strings(",")
 
-	if host == "" || port == "" {
+	if mode == ModeSingle && (host == "" || port == "") || mode != ModeSingle && len(addrs) == 0 {
 		panic("redis config " + redisName + " not found")
 	}
 
@@ -68,21 +83,73 @@ func NewRedis(redisName string) *redis.Client {
 		}
 	}
 
-	client := redis.NewClient(&redis.Options{
-		Network:      "tcp",
-		Addr:         host + ":" + port,
-		Password:     auth,
-		DialTimeout:  DefaultConnectTimeout,
-		ReadTimeout:  DefaultReadTimeout,
-		WriteTimeout: DefaultWriteTimeout,
-		PoolSize:     poolSize,
-		MinIdleConns: idleSize,
-		IdleTimeout:  180 * time.Second,
-	})
+	var client redis.UniversalClient
+	switch mode {
+	case ModeSentinel:
+		masterName := redisConf.Key(redisName + ".master_name").String()
+		if masterName == "" {
+			panic("redis config " + redisName + ".master_name not found")
+		}
+		client = redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:       masterName,
+			SentinelAddrs:    addrs,
+			SentinelPassword: redisConf.Key(redisName + ".sentinel_password").String(),
+			Password:         auth,
+			DialTimeout:      DefaultConnectTimeout,
+			ReadTimeout:      DefaultReadTimeout,
+			WriteTimeout:     DefaultWriteTimeout,
+			PoolSize:         poolSize,
+			MinIdleConns:     idleSize,
+			IdleTimeout:      180 * time.Second,
+		})
+	case ModeCluster:
+		// 连接池配置作用于每个节点
+		client = redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:        addrs,
+			Password:     auth,
+			DialTimeout:  DefaultConnectTimeout,
+			ReadTimeout:  DefaultReadTimeout,
+			WriteTimeout: DefaultWriteTimeout,
+			PoolSize:     poolSize,
+			MinIdleConns: idleSize,
+			IdleTimeout:  180 * time.Second,
+		})
+	default:
+		client = redis.NewClient(&redis.Options{
+			Network:      "tcp",
+			Addr:         host + ":" + port,
+			Password:     auth,
+			DialTimeout:  DefaultConnectTimeout,
+			ReadTimeout:  DefaultReadTimeout,
+			WriteTimeout: DefaultWriteTimeout,
+			PoolSize:     poolSize,
+			MinIdleConns: idleSize,
+			IdleTimeout:  180 * time.Second,
+		})
+	}
 	if err := client.Ping().Err(); err != nil {
 		log.Fatalln("[redis] " + err.Error())
 	}
 
 	redisMap.Store(redisName, client)
+	registerHealth(redisName, client)
 	return client
 }
+
+// poolStats returns the pool stats of client, cluster clients sum up every node
+func poolStats(client redis.UniversalClient) *redis.PoolStats {
+	if c, ok := client.(interface{ PoolStats() *redis.PoolStats }); ok {
+		return c.PoolStats()
+	}
+	return &redis.PoolStats{}
+}
+
+// registerHealth 注册 redis.{name} 健康检查，关闭后检查失败直至重新创建
+func registerHealth(redisName string, client redis.UniversalClient) {
+	health.Register("redis."+redisName, func(ctx context.Context) error {
+		return client.DoContext(ctx, "ping").Err()
+	}, health.Options{
+		Critical: redisConf.Key(redisName + ".health_critical").MustBool(true),
+		Timeout:  redisConf.Key(redisName + ".health_timeout").MustDuration(0),
+	})
+}
@@ -0,0 +1,110 @@
+// Package shutdown 统一关闭各模块持有的连接池等资源
+package shutdown
+
+import (
+	"context"
+	"log"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const DefaultTimeout = 10 * time.Second
+
+// Closer releases resources, it should return once ctx is done
+type Closer func(ctx context.Context) error
+
+type entry struct {
+	name   string
+	closer Closer
+}
+
+var (
+	closers []entry
+	mu      sync.Mutex
+)
+
+// Errors collects the errors of several closers
+type Errors []error
+
+func (e Errors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+// Err returns nil if e is empty
+func (e Errors) Err() error {
+	if len(e) == 0 {
+		return nil
+	}
+	return e
+}
+
+// Register adds a closer, closers run in reverse order of registration,
+// registering an existing name replaces the closer in place
+func Register(name string, closer Closer) {
+	mu.Lock()
+	defer mu.Unlock()
+
+	for i := range closers {
+		if closers[i].name == name {
+			closers[i].closer = closer
+			return
+		}
+	}
+	closers = append(closers, entry{name, closer})
+}
+
+// CloseAll runs every registered closer and returns their errors as Errors
+func CloseAll(ctx context.Context) error {
+	mu.Lock()
+	list := make([]entry, len(closers))
+	copy(list, closers)
+	mu.Unlock()
+
+	var errs Errors
+	for i := len(list) - 1; i >= 0; i-- {
+		if err := list[i].closer(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errs.Err()
+}
+
+// Wait blocks until one of signals (SIGINT, SIGTERM by default) is received, then runs CloseAll within timeout
+func Wait(timeout time.Duration, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{syscall.SIGINT, syscall.SIGTERM}
+	}
+
+	ch := make(chan os.Signal, 1)
+	signal.Notify(ch, signals...)
+	sig := <-ch
+	signal.Stop(ch)
+	log.Println("[shutdown] received " + sig.String())
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	return CloseAll(ctx)
+}
+
+// WaitIdle polls inUse until it reports 0 or ctx is done
+func WaitIdle(ctx context.Context, inUse func() int) error {
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+
+	for inUse() > 0 {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+	return nil
+}
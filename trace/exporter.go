@@ -0,0 +1,329 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/qkzsky/go-utils/config"
+	"github.com/qkzsky/go-utils/curl"
+	"github.com/qkzsky/go-utils/logger"
+	"github.com/qkzsky/go-utils/shutdown"
+	"gopkg.in/ini.v1"
+)
+
+const (
+	ExporterNone   = "none"
+	ExporterStdout = "stdout"
+	ExporterFile   = "file"
+	ExporterOTLP   = "otlp"
+
+	DefaultBatchSize     = 512
+	DefaultFlushInterval = 5 * time.Second
+	DefaultQueueSize     = 4096
+	DefaultOTLPTimeout   = 5 * time.Second
+)
+
+// Exporter exports a batch of finished spans, errors are printed to the standard logger
+type Exporter interface {
+	Export(spans []*Span) error
+}
+
+// ExporterFunc adapts a function to Exporter
+type ExporterFunc func(spans []*Span) error
+
+func (f ExporterFunc) Export(spans []*Span) error {
+	return f(spans)
+}
+
+var (
+	traceConf *ini.Section
+
+	exporterMu sync.RWMutex
+	exporter   Exporter
+	queue      chan *Span
+	flushReq   chan chan struct{}
+	dropped    uint64
+	startOnce  sync.Once
+)
+
+func init() {
+	traceConf = config.Section("trace")
+	queue = make(chan *Span, traceConf.Key("queue_size").MustInt(DefaultQueueSize))
+	flushReq = make(chan chan struct{})
+
+	switch name := traceConf.Key("exporter").In(ExporterNone, []string{ExporterNone, ExporterStdout, ExporterFile, ExporterOTLP}); name {
+	case ExporterStdout:
+		SetExporter(NewJSONExporter(os.Stdout))
+	case ExporterFile:
+		fileName := traceConf.Key("file").MustString(filepath.Join(logger.GetPath(), config.AppName+"-trace.log"))
+		e, err := NewFileExporter(fileName)
+		if err != nil {
+			log.Println("[trace] " + err.Error())
+			break
+		}
+		SetExporter(e)
+	case ExporterOTLP:
+		SetExporter(NewOTLPExporter(traceConf.Key("otlp.endpoint").String(),
+			traceConf.Key("otlp.timeout").MustDuration(DefaultOTLPTimeout)))
+	}
+
+	shutdown.Register("trace", func(ctx context.Context) error {
+		done := make(chan struct{})
+		go func() {
+			Flush()
+			close(done)
+		}()
+		select {
+		case <-done:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	})
+}
+
+// SetExporter sets the exporter, nil disables exporting. Spans finished while no exporter is set are discarded
+func SetExporter(e Exporter) {
+	exporterMu.Lock()
+	exporter = e
+	exporterMu.Unlock()
+
+	if e != nil {
+		startOnce.Do(func() {
+			go run(traceConf.Key("batch_size").MustInt(DefaultBatchSize),
+				traceConf.Key("flush_interval").MustDuration(DefaultFlushInterval))
+		})
+	}
+}
+
+// Enabled reports whether an exporter is set, callers may skip building spans otherwise
+func Enabled() bool {
+	exporterMu.RLock()
+	defer exporterMu.RUnlock()
+	return exporter != nil
+}
+
+// Dropped returns the number of spans discarded because the queue was full
+func Dropped() uint64 {
+	return atomic.LoadUint64(&dropped)
+}
+
+func enqueue(s *Span) {
+	if !Enabled() {
+		return
+	}
+	select {
+	case queue <- s:
+	default:
+		atomic.AddUint64(&dropped, 1)
+	}
+}
+
+// Flush exports the queued spans and waits for the export to finish
+func Flush() {
+	if !Enabled() {
+		return
+	}
+	done := make(chan struct{})
+	flushReq <- done
+	<-done
+}
+
+func run(batchSize int, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	batch := make([]*Span, 0, batchSize)
+	export := func() {
+		if len(batch) == 0 {
+			return
+		}
+		exporterMu.RLock()
+		e := exporter
+		exporterMu.RUnlock()
+		if e != nil {
+			if err := e.Export(batch); err != nil {
+				log.Println("[trace] export: " + err.Error())
+			}
+		}
+		batch = make([]*Span, 0, batchSize)
+	}
+
+	for {
+		select {
+		case s := <-queue:
+			batch = append(batch, s)
+			if len(batch) >= batchSize {
+				export()
+			}
+		case <-ticker.C:
+			export()
+		case done := <-flushReq:
+			for n := len(queue); n > 0; n-- {
+				batch = append(batch, <-queue)
+			}
+			export()
+			close(done)
+		}
+	}
+}
+
+// NewJSONExporter writes every span as one JSON line to w
+func NewJSONExporter(w io.Writer) Exporter {
+	var mu sync.Mutex
+	return ExporterFunc(func(spans []*Span) error {
+		mu.Lock()
+		defer mu.Unlock()
+
+		enc := json.NewEncoder(w)
+		for _, s := range spans {
+			if err := enc.Encode(s); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// NewFileExporter appends spans as JSON lines to fileName
+func NewFileExporter(fileName string) (Exporter, error) {
+	if err := os.MkdirAll(filepath.Dir(fileName), os.ModePerm); err != nil {
+		return nil, err
+	}
+	f, err := os.OpenFile(fileName, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return NewJSONExporter(f), nil
+}
+
+// otlp JSON 编码，见 opentelemetry-proto ExportTraceServiceRequest
+type otlpValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+}
+
+type otlpAttribute struct {
+	Key   string    `json:"key"`
+	Value otlpValue `json:"value"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string          `json:"traceId"`
+	SpanID            string          `json:"spanId"`
+	ParentSpanID      string          `json:"parentSpanId,omitempty"`
+	Name              string          `json:"name"`
+	Kind              int             `json:"kind"`
+	StartTimeUnixNano string          `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+	Attributes        []otlpAttribute `json:"attributes,omitempty"`
+	Status            otlpStatus      `json:"status"`
+}
+
+var otlpKinds = map[string]int{KindInternal: 1, KindServer: 2, KindClient: 3}
+
+func otlpAttr(key string, value interface{}) otlpAttribute {
+	a := otlpAttribute{Key: key}
+	switch v := value.(type) {
+	case string:
+		a.Value.StringValue = &v
+	case bool:
+		a.Value.BoolValue = &v
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		s := fmt.Sprintf("%d", v)
+		a.Value.IntValue = &s
+	case float32:
+		f := float64(v)
+		a.Value.DoubleValue = &f
+	case float64:
+		a.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprintf("%v", v)
+		a.Value.StringValue = &s
+	}
+	return a
+}
+
+func newOTLPSpan(s *Span) otlpSpan {
+	o := otlpSpan{
+		TraceID:           s.TraceID,
+		SpanID:            s.SpanID,
+		ParentSpanID:      s.ParentID,
+		Name:              s.Name,
+		Kind:              otlpKinds[s.Kind],
+		StartTimeUnixNano: strconv.FormatInt(s.Start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(s.End.UnixNano(), 10),
+	}
+	for k, v := range s.Attributes {
+		o.Attributes = append(o.Attributes, otlpAttr(k, v))
+	}
+	if s.Error != "" {
+		o.Status = otlpStatus{Code: 2, Message: s.Error}
+	}
+	return o
+}
+
+// NewOTLPExporter POST spans in OTLP/HTTP JSON encoding to endpoint, e.g. http://127.0.0.1:4318,
+// /v1/traces is appended if endpoint has no path
+func NewOTLPExporter(endpoint string, timeout time.Duration) Exporter {
+	if u, err := url.Parse(endpoint); err == nil && (u.Path == "" || u.Path == "/") {
+		u.Path = "/v1/traces"
+		endpoint = u.String()
+	}
+	service := traceConf.Key("service").MustString(config.AppName)
+
+	return ExporterFunc(func(spans []*Span) error {
+		otlpSpans := make([]otlpSpan, len(spans))
+		for i, s := range spans {
+			otlpSpans[i] = newOTLPSpan(s)
+		}
+		body := map[string]interface{}{
+			"resourceSpans": []interface{}{
+				map[string]interface{}{
+					"resource": map[string]interface{}{
+						"attributes": []otlpAttribute{otlpAttr("service.name", service)},
+					},
+					"scopeSpans": []interface{}{
+						map[string]interface{}{
+							"scope": map[string]string{"name": "github.com/qkzsky/go-utils/trace"},
+							"spans": otlpSpans,
+						},
+					},
+				},
+			},
+		}
+
+		req, err := curl.Post(endpoint).SetTimeout(timeout, timeout).JSONBody(body)
+		if err != nil {
+			return err
+		}
+		if _, err = req.Bytes(); err != nil {
+			return err
+		}
+		resp, err := req.Response()
+		if err != nil {
+			return err
+		}
+		if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+			return fmt.Errorf("otlp %s response %s", endpoint, resp.Status)
+		}
+		return nil
+	})
+}
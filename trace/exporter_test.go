@@ -0,0 +1,106 @@
+package trace
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestOTLPExporter(t *testing.T) {
+	var (
+		path string
+		body struct {
+			ResourceSpans []struct {
+				Resource struct {
+					Attributes []otlpAttribute `json:"attributes"`
+				} `json:"resource"`
+				ScopeSpans []struct {
+					Spans []otlpSpan `json:"spans"`
+				} `json:"scopeSpans"`
+			} `json:"resourceSpans"`
+		}
+	)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer srv.Close()
+
+	ctx, parent := Start(context.Background(), "GET /", KindServer)
+	_, span := Start(ctx, "SELECT users", KindClient)
+	span.SetAttribute("db.rows_affected", int64(3))
+	span.SetError(errors.New("timeout"))
+	span.End = span.Start.Add(time.Millisecond)
+
+	if err := NewOTLPExporter(srv.URL, time.Second).Export([]*Span{span}); err != nil {
+		t.Fatal(err)
+	}
+	if path != "/v1/traces" {
+		t.Errorf("path = %s, want /v1/traces", path)
+	}
+	if len(body.ResourceSpans) != 1 || len(body.ResourceSpans[0].ScopeSpans) != 1 {
+		t.Fatalf("body = %+v", body)
+	}
+	if attrs := body.ResourceSpans[0].Resource.Attributes; len(attrs) != 1 || *attrs[0].Value.StringValue != "go-utils" {
+		t.Errorf("resource attributes = %+v", attrs)
+	}
+
+	spans := body.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 {
+		t.Fatalf("got %d spans, want 1", len(spans))
+	}
+	s := spans[0]
+	if s.TraceID != parent.TraceID || s.ParentSpanID != parent.SpanID || s.SpanID != span.SpanID {
+		t.Errorf("ids = %s/%s/%s", s.TraceID, s.ParentSpanID, s.SpanID)
+	}
+	if s.Name != "SELECT users" || s.Kind != 3 {
+		t.Errorf("name, kind = %s, %d", s.Name, s.Kind)
+	}
+	if s.Status.Code != 2 || s.Status.Message != "timeout" {
+		t.Errorf("status = %+v", s.Status)
+	}
+	if len(s.Attributes) != 1 || s.Attributes[0].Value.IntValue == nil || *s.Attributes[0].Value.IntValue != "3" {
+		t.Errorf("attributes = %+v", s.Attributes)
+	}
+}
+
+func TestOTLPExporterError(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer srv.Close()
+
+	_, span := Start(context.Background(), "op", KindInternal)
+	if err := NewOTLPExporter(srv.URL+"/custom", time.Second).Export([]*Span{span}); err == nil {
+		t.Fatal("want error for 400 response")
+	}
+}
+
+func TestParseTraceparent(t *testing.T) {
+	tests := []struct {
+		value   string
+		traceID string
+		spanID  string
+		ok      bool
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{" 00-4BF92F3577B34DA6A3CE929D0E0E4736-00F067AA0BA902B7-00 ", "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7", true},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", "", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", "", "", false},
+		{"00-4bf92f3577b34da6a3ce929d0e0e473-00f067aa0ba902b7-01", "", "", false},
+		{"00-zzf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "", "", false},
+		{"", "", "", false},
+	}
+	for _, tt := range tests {
+		traceID, spanID, err := ParseTraceparent(tt.value)
+		if (err == nil) != tt.ok || traceID != tt.traceID || spanID != tt.spanID {
+			t.Errorf("ParseTraceparent(%q) = %q, %q, %v", tt.value, traceID, spanID, err)
+		}
+	}
+}
@@ -0,0 +1,158 @@
+// Package trace 轻量链路追踪：Span 随 context.Context 传递，结束后批量交给 Exporter 导出，
+// 由 [trace] exporter 配置 stdout、file 或 OTLP/HTTP 导出
+package trace
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	KindInternal = "internal"
+	KindServer   = "server"
+	KindClient   = "client"
+
+	TraceparentHeader = "traceparent"
+)
+
+type spanKey struct{}
+
+// Span is one timed operation of a trace, IDs are lowercase hex as in W3C traceparent
+type Span struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_id,omitempty"`
+	Name       string                 `json:"name"`
+	Kind       string                 `json:"kind"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+
+	mu    sync.Mutex
+	ended bool
+}
+
+func randomID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
+
+// FromContext returns the span of ctx, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithSpan returns a copy of ctx carrying span
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// Start 开始一个 span，ctx 中已有 span 时作为其子 span，否则开始新的 trace
+func Start(ctx context.Context, name, kind string) (context.Context, *Span) {
+	span := &Span{
+		SpanID: randomID(8),
+		Name:   name,
+		Kind:   kind,
+		Start:  time.Now(),
+	}
+	if parent := FromContext(ctx); parent != nil {
+		span.TraceID, span.ParentID = parent.TraceID, parent.SpanID
+	} else {
+		span.TraceID = randomID(16)
+	}
+	return ContextWithSpan(ctx, span), span
+}
+
+// SetAttribute sets an attribute, value should be a string, number or bool
+func (s *Span) SetAttribute(key string, value interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.Attributes == nil {
+		s.Attributes = map[string]interface{}{}
+	}
+	s.Attributes[key] = value
+}
+
+// SetError marks the span as failed, nil is ignored
+func (s *Span) SetError(err error) {
+	if err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.Error = err.Error()
+}
+
+// Finish 结束 span 并交给 exporter，重复调用只生效一次
+func (s *Span) Finish() {
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.End = time.Now()
+	s.mu.Unlock()
+
+	enqueue(s)
+}
+
+// Traceparent returns the W3C traceparent header value of the span
+func (s *Span) Traceparent() string {
+	return "00-" + s.TraceID + "-" + s.SpanID + "-01"
+}
+
+// ParseTraceparent returns the trace id and parent span id of a W3C traceparent header value
+func ParseTraceparent(value string) (traceID, spanID string, err error) {
+	parts := strings.Split(strings.TrimSpace(value), "-")
+	if len(parts) < 4 || len(parts[1]) != 32 || len(parts[2]) != 16 {
+		return "", "", fmt.Errorf("trace: invalid traceparent %q", value)
+	}
+	if _, err := hex.DecodeString(parts[1] + parts[2]); err != nil {
+		return "", "", fmt.Errorf("trace: invalid traceparent %q", value)
+	}
+	if parts[1] == strings.Repeat("0", 32) || parts[2] == strings.Repeat("0", 16) {
+		return "", "", fmt.Errorf("trace: invalid traceparent %q", value)
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), nil
+}
+
+// Middleware 为每个请求开始一个 server span，沿用请求头 traceparent 中的 trace，
+// span 绑定至 c.Request 的 context，database.WithGin 派生的句柄据此记录子 span
+func Middleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ctx := c.Request.Context()
+		if traceID, parentID, err := ParseTraceparent(c.GetHeader(TraceparentHeader)); err == nil {
+			ctx = ContextWithSpan(ctx, &Span{TraceID: traceID, SpanID: parentID})
+		}
+
+		ctx, span := Start(ctx, c.Request.Method+" "+c.FullPath(), KindServer)
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.target", c.Request.URL.Path)
+		c.Request = c.Request.WithContext(ctx)
+		c.Header(TraceparentHeader, span.Traceparent())
+
+		c.Next()
+
+		span.SetAttribute("http.status_code", c.Writer.Status())
+		if len(c.Errors) > 0 {
+			span.SetError(c.Errors.Last())
+		} else if c.Writer.Status() >= 500 {
+			span.SetError(fmt.Errorf("http status %d", c.Writer.Status()))
+		}
+		span.Finish()
+	}
+}